@@ -2,19 +2,29 @@ package cli
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
 	"time"
 )
 
+// The exit code for usage errors, following the POSIX convention
+const DefaultUsageErrorExitCode = 2
+
 // App is the main structure of a cli application. It is recomended that
 // and app be created with the cli.NewApp() function
 type App struct {
-	// The name of the program. Defaults to os.Args[0]
+	// The name of the program. Defaults to the base name of the program the
+	// App is run as, os.Args[0]
 	Name string
 	// Description of the program.
 	Usage string
-	// Version of the program
+	// The synopsis shown under USAGE in the help, replacing the generated one
+	UsageText string
+	// Version of the program. When empty, Run takes it from BuildVersion
 	Version string
 	// List of commands to execute
 	Commands []Command
@@ -22,23 +32,149 @@ type App struct {
 	Flags []Flag
 	// Boolean to enable bash completion commands
 	EnableBashCompletion bool
+	// The prefix of the environment variables flags that are not given on the
+	// command line fall back to, such as APP for APP_LOG_LEVEL to set
+	// --log-level. Flags with an EnvVar of their own are not affected.
+	EnvPrefix string
+	// Boolean to enable the global --config flag, which loads flag values from
+	// JSON, YAML or TOML files. It can be given several times, later files overriding
+	// earlier ones. A value from a file applies to the flags of that name at
+	// every level that were neither given on the command line nor set from the
+	// environment, so the command line wins over the environment, which wins
+	// over config files, which win over the defaults.
+	UseConfigFlag bool
+	// Boolean to log diagnostics about how the command line is dispatched,
+	// such as positional arguments that are also the names of commands, and
+	// the commands that use the deprecated ShortName
+	Debug bool
+	// Boolean to enable the global --completion flag, which prints the
+	// completion script for the shell named in $SHELL
+	EnableCompletionFlag bool
+	// Boolean to enable the global --dry-run flag, see Context.DryRun
+	EnableDryRun bool
+	// Boolean to show help through the pager in $PAGER when writing to a
+	// terminal. Help is written straight to Writer otherwise.
+	UsePager bool
+	// Boolean to enable the global --quiet flag, see Context.Quiet
+	EnableQuiet bool
+	// Boolean to enable the global --yes flag, see Context.AssumeYes
+	EnableAssumeYes bool
+	// The prefix of the negated counterparts of bool flags, so that with "no-"
+	// --no-cache sets --cache to false. Empty disables the counterparts, so
+	// an App literal has none unless it sets the "no-" of NewApp.
+	BoolNegationPrefix string
+	// Boolean to print a one-line synopsis instead of the full help when the
+	// command line cannot be parsed
+	CompactUsageOnError bool
 	// An action to execute when the bash-completion flag is set
 	BashComplete func(context *Context)
 	// An action to execute before any subcommands are run, but after the context is ready
 	// If a non-nil error is returned, no subcommands are run
 	Before func(context *Context) error
-	// The action to execute when no subcommands are specified
-	Action func(context *Context)
+	// An action to execute right before each command is run, at every level
+	// of the command tree, with the context of the level that dispatches it.
+	// If a non-nil error is returned, the command is not run
+	BeforeCommand func(context *Context, command *Command) error
+	// An action to execute after the subcommand or default action has finished,
+	// even if it or Before failed. Its error is returned from Run only when
+	// nothing else failed.
+	After func(context *Context) error
+	// The action to execute when no subcommands are specified. Its error is
+	// returned from Run, wrap an action that returns nothing with ActionFunc
+	Action func(context *Context) error
+	// The code of the error Run returns after showing the help when there is
+	// no Action to run. Zero means no error is returned
+	NoActionExitCode int
+	// Rewrites the arguments, without the program name, before they are parsed.
+	// If a non-nil error is returned, nothing is run. See ChainPreprocessors
+	PreprocessArgs func(args []string) ([]string, error)
 	// Execute this function if the proper command cannot be found
 	CommandNotFound func(context *Context, command string)
+	// Execute this function with any error returned by an Action or a hook,
+	// before the error is returned from Run. Nil by default, in which case
+	// only RunAndExitOnError reports the error. See DefaultExitErrHandler.
+	ExitErrHandler func(context *Context, err error)
+	// Where help, versions and usage errors are written. Defaults to os.Stdout
+	Writer io.Writer
+	// Where answers to prompts, such as Context.Confirm, are read from.
+	// Defaults to os.Stdin
+	Reader io.Reader
+	// Where errors are written. Defaults to os.Stderr
+	ErrWriter io.Writer
+	// The code RunAndExitOnError exits with when the command line could not be
+	// parsed. Defaults to DefaultUsageErrorExitCode
+	UsageErrorExitCode int
+	// Receives the warnings of the cli package, such as deprecation notices.
+	// Defaults to writing to ErrWriter
+	Logger Logger
 	// Compilation date
 	Compiled time.Time
 	// Author
 	Author string
 	// Author e-mail
 	Email string
+	// Application specific data, such as loggers or API clients, made
+	// available to every action through Context.AppContext
+	Context interface{}
+	// The context the last action ran with, see RunContext
+	ranContext *Context
+	// Whether negative numbers are positional arguments, set from the
+	// AllowNegativeNumberArgs of the command the App runs
+	negativeNumberArgs bool
 }
 
+// Returns the version of the program recorded in its build info, such as
+// "v1.2.0 (1a2b3c4d5e6f, 2024-01-02T15:04:05Z)" for a program installed with
+// go install, or "" when no version was recorded. Run uses it when the App
+// has no Version. Override it to take the version from elsewhere.
+var BuildVersion = func() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+
+	var revision, modified, built string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		case "vcs.time":
+			built = setting.Value
+		}
+	}
+
+	version := info.Main.Version
+	if version == "" || version == "(devel)" {
+		if revision == "" {
+			return ""
+		}
+		version = "devel"
+	}
+
+	var details []string
+	if revision != "" {
+		if len(revision) > 12 {
+			revision = revision[:12]
+		}
+		if modified == "true" {
+			revision += "+dirty"
+		}
+		details = append(details, revision)
+	}
+	if built != "" {
+		details = append(details, built)
+	}
+	if len(details) > 0 {
+		version += " (" + strings.Join(details, ", ") + ")"
+	}
+	return version
+}
+
+// The version of Apps that have none, and none in their build info
+const defaultVersion = "0.0.0"
+
 // Tries to find out when this binary was compiled.
 // Returns the current time if it fails to find it.
 func compileTime() time.Time {
@@ -49,22 +185,47 @@ func compileTime() time.Time {
 	return info.ModTime()
 }
 
-// Creates a new cli Application with some reasonable defaults for Name, Usage, Version and Action.
+// Creates a new cli Application with some reasonable defaults for Name, Usage and Action.
+// The Version is left empty for Run to take from the build info.
 func NewApp() *App {
 	return &App{
-		Name:         os.Args[0],
-		Usage:        "A new cli application",
-		Version:      "0.0.0",
-		BashComplete: DefaultAppComplete,
-		Action:       helpCommand.Action,
-		Compiled:     compileTime(),
-		Author:       "Author",
-		Email:        "unknown@email",
+		Name:               filepath.Base(os.Args[0]),
+		Usage:              "A new cli application",
+		BashComplete:       DefaultAppComplete,
+		Action:             helpCommand.Action,
+		BoolNegationPrefix: "no-",
+		Compiled:           compileTime(),
+		Author:             "Author",
+		Email:              "unknown@email",
 	}
 }
 
 // Entry point to the cli app. Parses the arguments slice and routes to the proper flag/args combination
-func (a *App) Run(arguments []string) error {
+func (a *App) Run(arguments []string) (err error) {
+	if err := checkCommandNames(a.Commands, ""); err != nil {
+		return err
+	}
+
+	// name the app after the program it was invoked as
+	if a.Name == "" && len(arguments) > 0 {
+		a.Name = filepath.Base(arguments[0])
+	}
+
+	if a.Version == "" {
+		a.Version = BuildVersion()
+		if a.Version == "" {
+			a.Version = defaultVersion
+		}
+	}
+
+	if a.PreprocessArgs != nil && len(arguments) > 0 {
+		args, err := a.PreprocessArgs(append([]string{}, arguments[1:]...))
+		if err != nil {
+			return err
+		}
+		arguments = append([]string{arguments[0]}, args...)
+	}
+
 	// append help to commands
 	if a.Command(helpCommand.Name) == nil {
 		a.Commands = append(a.Commands, helpCommand)
@@ -74,28 +235,66 @@ func (a *App) Run(arguments []string) error {
 	if a.EnableBashCompletion {
 		a.appendFlag(BashCompletionFlag)
 	}
+	if a.UseConfigFlag {
+		a.appendFlag(ConfigFlag)
+	}
+	if a.EnableCompletionFlag {
+		a.appendFlag(CompletionFlag)
+	}
+	if a.EnableDryRun {
+		a.appendFlag(DryRunFlag)
+	}
+	if a.EnableQuiet {
+		a.appendFlag(QuietFlag)
+	}
+	if a.EnableAssumeYes {
+		a.appendFlag(AssumeYesFlag)
+	}
 	a.appendFlag(VersionFlag)
 	a.appendFlag(HelpFlag)
 
 	// parse flags
-	set := flagSet(a.Name, a.Flags)
+	set, err := flagSet(a.Name, a.Flags, a.BoolNegationPrefix)
+	if err != nil {
+		return err
+	}
 	set.SetOutput(ioutil.Discard)
-	err := set.Parse(arguments[1:])
+	input := expandShortFlags(arguments[1:], set)
+	var completing *CompletedFlag
+	if a.EnableBashCompletion {
+		input, completing = splitValueCompletion(input, a.Flags)
+	}
+	err = unknownFlagError(redactParseError(set.Parse(input), a.Flags), set, a.Flags)
 	nerr := normalizeFlags(a.Flags, set)
 	if nerr != nil {
-		fmt.Println(nerr)
 		context := NewContext(a, set, set)
+		if a.CompactUsageOnError {
+			showCompactUsage(context, nerr, appSynopsis(a), a.Name)
+			return &ParseError{Command: a.Name, Err: nerr}
+		}
+		fmt.Fprintln(a.writer(), nerr)
 		ShowAppHelp(context)
-		fmt.Println("")
-		return nerr
+		fmt.Fprintln(a.writer())
+		return &ParseError{Command: a.Name, Err: nerr}
 	}
 	context := NewContext(a, set, set)
+	context.terminated = flagsTerminated(input, set)
+	a.ranContext = context
 
 	if err != nil {
-		fmt.Printf("Incorrect Usage.\n\n")
+		if a.CompactUsageOnError {
+			showCompactUsage(context, err, appSynopsis(a), a.Name)
+			return &ParseError{Command: a.Name, Err: err}
+		}
+		fmt.Fprintf(a.writer(), "%s.\n\n", IncorrectUsageText)
 		ShowAppHelp(context)
-		fmt.Println("")
-		return err
+		fmt.Fprintln(a.writer())
+		return &ParseError{Command: a.Name, Err: err}
+	}
+
+	if completing != nil {
+		completing.complete(context)
+		return nil
 	}
 
 	if checkCompletions(context) {
@@ -110,9 +309,36 @@ func (a *App) Run(arguments []string) error {
 		return nil
 	}
 
+	if a.EnableCompletionFlag && context.Bool(CompletionFlag.Name) {
+		return printShellCompletion(context)
+	}
+
+	if a.After != nil {
+		defer func() {
+			afterErr := a.After(context)
+			if afterErr != nil {
+				a.handleExitErr(context, afterErr)
+				if err == nil {
+					err = afterErr
+				}
+			}
+		}()
+	}
+
+	if a.UseConfigFlag {
+		if err := context.loadConfig(); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveFlags(a.Flags, context); err != nil {
+		return err
+	}
+
 	if a.Before != nil {
 		err := a.Before(context)
 		if err != nil {
+			a.handleExitErr(context, err)
 			return err
 		}
 	}
@@ -122,17 +348,104 @@ func (a *App) Run(arguments []string) error {
 		name := args.First()
 		c := a.Command(name)
 		if c != nil {
-			return c.Run(context)
+			return a.runCommand(context, c)
 		}
 	}
 
+	// help and version given after positional args
+	if argsHaveFlag(args, HelpFlag, nil) {
+		ShowAppHelp(context)
+		return nil
+	}
+	if argsHaveFlag(args, VersionFlag, nil) {
+		ShowVersion(context)
+		return nil
+	}
+
+	// without an Action there is nothing to run but the help
+	if a.Action == nil {
+		ShowAppHelp(context)
+		if a.NoActionExitCode != 0 {
+			return NewExitError("", a.NoActionExitCode)
+		}
+		return nil
+	}
+
 	// Run default Action
-	a.Action(context)
-	return nil
+	context.markRan()
+	return a.runAction(context, a.Action)
+}
+
+// Combines argument preprocessors into one for App.PreprocessArgs, which
+// calls each in turn with the arguments returned by the one before it
+func ChainPreprocessors(preprocessors ...func(args []string) ([]string, error)) func(args []string) ([]string, error) {
+	return func(args []string) ([]string, error) {
+		for _, preprocess := range preprocessors {
+			var err error
+			args, err = preprocess(args)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return args, nil
+	}
+}
+
+// Adapts an action that returns nothing to the error returning form of
+// App.Action and Command.Action. The adapted action always returns nil.
+func ActionFunc(action func(context *Context)) func(context *Context) error {
+	return func(context *Context) error {
+		action(context)
+		return nil
+	}
+}
+
+// Runs the App with the given arguments like Run, returning the context the
+// action ran with along with any error. When no action ran, such as when help
+// was shown, the context of the App itself is returned. Combined with Writer
+// this allows commands to be tested without touching os.Args or os.Stdout.
+func (a *App) RunContext(arguments []string) (*Context, error) {
+	a.ranContext = nil
+	err := a.Run(arguments)
+	return a.ranContext, err
+}
+
+// Runs the App with os.Args and exits when it returns an error. Usage errors,
+// which have already been printed along with the help, exit with
+// UsageErrorExitCode. Other errors exit with their code when they are an
+// ExitCoder, or 1.
+func (a *App) RunAndExitOnError() {
+	err := a.Run(os.Args)
+	if err == nil {
+		return
+	}
+	// usage errors are shown with the help, handled errors by the handler
+	if _, ok := err.(*ParseError); !ok && a.ExitErrHandler == nil {
+		fmt.Fprintln(a.errWriter(), err)
+	}
+	OsExiter(a.exitCode(err))
+}
+
+// Returns the code the program should exit with for err
+func (a *App) exitCode(err error) int {
+	if _, ok := err.(*ParseError); ok {
+		if a.UsageErrorExitCode != 0 {
+			return a.UsageErrorExitCode
+		}
+		return DefaultUsageErrorExitCode
+	}
+	if exitErr, ok := err.(ExitCoder); ok {
+		return exitErr.ExitCode()
+	}
+	return 1
 }
 
 // Invokes the subcommand given the context, parses ctx.Args() to generate command-specific flags
 func (a *App) RunAsSubcommand(ctx *Context) error {
+	if err := checkCommandNames(a.Commands, ""); err != nil {
+		return err
+	}
+
 	// append help to commands
 	if len(a.Commands) > 0 {
 		if a.Command(helpCommand.Name) == nil {
@@ -147,27 +460,65 @@ func (a *App) RunAsSubcommand(ctx *Context) error {
 	a.appendFlag(HelpFlag)
 
 	// parse flags
-	set := flagSet(a.Name, a.Flags)
+	set, err := flagSet(a.Name, a.Flags, a.BoolNegationPrefix)
+	if err != nil {
+		return err
+	}
 	set.SetOutput(ioutil.Discard)
-	err := set.Parse(ctx.Args().Tail())
+	input := ctx.rawArgs().Tail()
+	var positional []string
+	if a.negativeNumberArgs {
+		input, positional = splitNegativeNumberArgs(input, set, true)
+	}
+	input = expandShortFlags(input, set)
+	var completing *CompletedFlag
+	if a.EnableBashCompletion {
+		input, completing = splitValueCompletion(input, a.Flags)
+	}
+	err = set.Parse(input)
+	if err == nil && len(positional) > 0 {
+		// parsed after a "--" so that negative numbers are not read as flags
+		err = set.Parse(append([]string{"--"}, positional...))
+	}
+	input = append(input, positional...)
+	err = unknownFlagError(redactParseError(err, a.Flags), set, a.Flags)
 	nerr := normalizeFlags(a.Flags, set)
 	context := NewContext(a, set, set)
+	context.parentContext = ctx
+	context.terminated = flagsTerminated(input, set)
+
+	if (nerr != nil || err != nil) && a.CompactUsageOnError {
+		if err == nil {
+			err = nerr
+		}
+		synopsis := appSynopsis(a)
+		if c := ctx.App.Command(ctx.Args().First()); len(a.Commands) == 0 && c != nil {
+			synopsis = commandSynopsis(ctx.App, *c)
+		}
+		showCompactUsage(context, err, synopsis, a.Name)
+		return &ParseError{Command: a.Name, Err: err}
+	}
 
 	if nerr != nil {
-		fmt.Println(nerr)
+		fmt.Fprintln(a.writer(), nerr)
 		if len(a.Commands) > 0 {
 			ShowSubcommandHelp(context)
 		} else {
 			ShowCommandHelp(ctx, context.Args().First())
 		}
-		fmt.Println("")
-		return nerr
+		fmt.Fprintln(a.writer())
+		return &ParseError{Command: a.Name, Err: nerr}
 	}
 
 	if err != nil {
-		fmt.Printf("Incorrect Usage.\n\n")
+		fmt.Fprintf(a.writer(), "%s.\n\n", IncorrectUsageText)
 		ShowSubcommandHelp(context)
-		return err
+		return &ParseError{Command: a.Name, Err: err}
+	}
+
+	if completing != nil {
+		completing.complete(context)
+		return nil
 	}
 
 	if checkCompletions(context) {
@@ -184,9 +535,14 @@ func (a *App) RunAsSubcommand(ctx *Context) error {
 		}
 	}
 
+	if err := resolveFlags(a.Flags, context); err != nil {
+		return err
+	}
+
 	if a.Before != nil {
 		err := a.Before(context)
 		if err != nil {
+			a.handleExitErr(context, err)
 			return err
 		}
 	}
@@ -196,18 +552,29 @@ func (a *App) RunAsSubcommand(ctx *Context) error {
 		name := args.First()
 		c := a.Command(name)
 		if c != nil {
-			return c.Run(context)
+			return a.runCommand(context, c)
 		}
 	}
 
-	// Run default Action
-	if len(a.Commands) > 0 {
-		a.Action(context)
-	} else {
-		a.Action(ctx)
+	// help given after positional args
+	if argsHaveFlag(args, HelpFlag, nil) {
+		if len(a.Commands) > 0 {
+			ShowSubcommandHelp(context)
+		} else {
+			ShowCommandHelp(ctx, ctx.Args().First())
+		}
+		return nil
 	}
 
-	return nil
+	// without an Action there is nothing to run but the help
+	if len(a.Commands) == 0 && a.Action == nil {
+		ShowCommandHelp(ctx, ctx.Args().First())
+		return nil
+	}
+
+	// Run default Action
+	context.markRan()
+	return a.runAction(context, a.Action)
 }
 
 // Returns the named command on App. Returns nil if the command does not exist
@@ -221,6 +588,47 @@ func (a *App) Command(name string) *Command {
 	return nil
 }
 
+// Appends a command to the App, such as one a plugin provides. Like the
+// commands of a literal, it is checked when the App runs.
+func (a *App) AddCommand(cmd Command) {
+	a.Commands = append(a.Commands, cmd)
+}
+
+// Calls fn with every command of the App, depth first, each before its
+// subcommands. The path holds the names of the command and its parents from
+// the top level down, such as ["remote", "add"]. fn is given a copy of the
+// command, so changing it leaves the App alone.
+func (a *App) Walk(fn func(path []string, cmd *Command)) {
+	walkCommands(a.Commands, nil, fn)
+}
+
+func walkCommands(commands []Command, parent []string, fn func(path []string, cmd *Command)) {
+	for _, c := range commands {
+		path := append(append([]string{}, parent...), c.Name)
+		fn(path, &c)
+		walkCommands(c.Subcommands, path, fn)
+	}
+}
+
+// Calls action with context, passing the error it returns to the
+// ExitErrHandler
+func (a *App) runAction(context *Context, action func(context *Context) error) error {
+	err := action(context)
+	a.handleExitErr(context, err)
+	return err
+}
+
+// Runs the command the context dispatched to, after BeforeCommand
+func (a *App) runCommand(context *Context, c *Command) error {
+	if a.BeforeCommand != nil {
+		if err := a.BeforeCommand(context, c); err != nil {
+			a.handleExitErr(context, err)
+			return err
+		}
+	}
+	return c.Run(context)
+}
+
 func (a *App) hasFlag(flag Flag) bool {
 	for _, f := range a.Flags {
 		if flag == f {
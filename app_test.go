@@ -1,9 +1,11 @@
 package cli_test
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/zenoss/cli"
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -16,8 +18,9 @@ func ExampleApp() {
 	app.Flags = []cli.Flag{
 		cli.StringFlag{Name: "name", Value: "bob", Usage: "a name to say"},
 	}
-	app.Action = func(c *cli.Context) {
+	app.Action = func(c *cli.Context) error {
 		fmt.Printf("Hello %v\n", c.String("name"))
+		return nil
 	}
 	app.Run(os.Args)
 	// Output:
@@ -44,8 +47,9 @@ func ExampleAppSubcommand() {
 					Flags: []cli.Flag{
 						cli.StringFlag{"name", "Bob", "Name of the person to greet"},
 					},
-					Action: func(c *cli.Context) {
+					Action: func(c *cli.Context) error {
 						fmt.Println("Hello,", c.String("name"))
+						return nil
 					},
 				},
 			},
@@ -72,8 +76,9 @@ func ExampleAppHelp() {
 			ShortName:   "d",
 			Usage:       "use it to see a description",
 			Description: "This is how we describe describeit the function",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				fmt.Printf("i like to describe things")
+				return nil
 			},
 		},
 	}
@@ -83,12 +88,17 @@ func ExampleAppHelp() {
 	//    describeit - use it to see a description
 	//
 	// USAGE:
-	//    command describeit [command options] [arguments...]
+	//    greet describeit [command options] [arguments...]
 	//
 	// DESCRIPTION:
 	//    This is how we describe describeit the function
 	//
 	// OPTIONS:
+	//
+	// GLOBAL OPTIONS:
+	//    --name 'bob'   a name to say
+	//    --version, -v  print the version
+	//    --help, -h     show help
 }
 
 func ExampleAppBashComplete() {
@@ -104,15 +114,17 @@ func ExampleAppBashComplete() {
 			ShortName:   "d",
 			Usage:       "use it to see a description",
 			Description: "This is how we describe describeit the function",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				fmt.Printf("i like to describe things")
+				return nil
 			},
 		}, {
 			Name:        "next",
 			Usage:       "next example",
 			Description: "more stuff to see when generating bash completion",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				fmt.Printf("the next example")
+				return nil
 			},
 		},
 	}
@@ -130,8 +142,9 @@ func TestApp_Run(t *testing.T) {
 	s := ""
 
 	app := cli.NewApp()
-	app.Action = func(c *cli.Context) {
+	app.Action = func(c *cli.Context) error {
 		s = s + c.Args().First()
+		return nil
 	}
 
 	err := app.Run([]string{"command", "foo"})
@@ -141,6 +154,29 @@ func TestApp_Run(t *testing.T) {
 	expect(t, s, "foobar")
 }
 
+func TestApp_ActionError(t *testing.T) {
+	app := cli.NewApp()
+	app.Action = func(c *cli.Context) error {
+		return fmt.Errorf("boom")
+	}
+
+	err := app.Run([]string{"command"})
+	refute(t, err, nil)
+	expect(t, err.Error(), "boom")
+}
+
+func TestActionFunc(t *testing.T) {
+	ran := false
+	app := cli.NewApp()
+	app.Action = cli.ActionFunc(func(c *cli.Context) {
+		ran = true
+	})
+
+	err := app.Run([]string{"command"})
+	expect(t, err, nil)
+	expect(t, ran, true)
+}
+
 var commandAppTests = []struct {
 	name     string
 	expected bool
@@ -167,6 +203,77 @@ func TestApp_Command(t *testing.T) {
 	}
 }
 
+func TestApp_AddCommand(t *testing.T) {
+	var ran string
+	plugin := cli.Command{Name: "plugin", Usage: "run a plugin"}
+	plugin.AddSubcommand(cli.Command{
+		Name: "deploy",
+		Action: func(c *cli.Context) error {
+			ran = c.Args().First()
+			return nil
+		},
+	})
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "tool"
+	app.Writer = &out
+	app.EnableBashCompletion = true
+	app.AddCommand(plugin)
+
+	err := app.Run([]string{"tool", "plugin", "deploy", "prod"})
+	expect(t, err, nil)
+	expect(t, ran, "prod")
+
+	err = app.Run([]string{"tool", "--help"})
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "   plugin   run a plugin\n"), true)
+
+	out.Reset()
+	err = app.Run([]string{"tool", "--generate-bash-completion"})
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "plugin\n"), true)
+
+	app.AddCommand(cli.Command{Name: "plugin"})
+	err = app.Run([]string{"tool", "plugin", "deploy"})
+	refute(t, err, nil)
+}
+
+func TestApp_Walk(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:  "remote",
+			Usage: "manage remotes",
+			Subcommands: []cli.Command{
+				{Name: "add", Usage: "add a remote"},
+				{
+					Name:  "branch",
+					Usage: "manage remote branches",
+					Subcommands: []cli.Command{
+						{Name: "prune"},
+					},
+				},
+			},
+		},
+		{Name: "status", Usage: "show the status"},
+	}
+
+	var paths []string
+	var missingUsage []string
+	app.Walk(func(path []string, cmd *cli.Command) {
+		paths = append(paths, strings.Join(path, " "))
+		if cmd.Usage == "" {
+			missingUsage = append(missingUsage, strings.Join(path, " "))
+		}
+		cmd.Name = "changed"
+	})
+	expect(t, len(paths), 5)
+	expect(t, strings.Join(paths, ", "), "remote, remote add, remote branch, remote branch prune, status")
+	expect(t, strings.Join(missingUsage, ", "), "remote branch prune")
+	expect(t, app.Commands[0].Name, "remote")
+}
+
 func TestApp_CommandWithArgBeforeFlags(t *testing.T) {
 	var parsedOption, firstArg string
 
@@ -176,9 +283,10 @@ func TestApp_CommandWithArgBeforeFlags(t *testing.T) {
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "option", Value: "", Usage: "some option"},
 		},
-		Action: func(c *cli.Context) {
+		Action: func(c *cli.Context) error {
 			parsedOption = c.String("option")
 			firstArg = c.Args().First()
+			return nil
 		},
 	}
 	app.Commands = []cli.Command{command}
@@ -196,8 +304,9 @@ func TestApp_Float64Flag(t *testing.T) {
 	app.Flags = []cli.Flag{
 		cli.Float64Flag{Name: "height", Value: 1.5, Usage: "Set the height, in meters"},
 	}
-	app.Action = func(c *cli.Context) {
+	app.Action = func(c *cli.Context) error {
 		meters = c.Float64("height")
+		return nil
 	}
 
 	app.Run([]string{"", "--height", "1.93"})
@@ -216,11 +325,12 @@ func TestApp_ParseSliceFlags(t *testing.T) {
 			cli.IntSliceFlag{Name: "p", Value: &cli.IntSlice{}, Usage: "set one or more ip addr"},
 			cli.StringSliceFlag{Name: "ip", Value: &cli.StringSlice{}, Usage: "set one or more ports to open"},
 		},
-		Action: func(c *cli.Context) {
+		Action: func(c *cli.Context) error {
 			parsedIntSlice = c.IntSlice("p")
 			parsedStringSlice = c.StringSlice("ip")
 			parsedOption = c.String("option")
 			firstArg = c.Args().First()
+			return nil
 		},
 	}
 	app.Commands = []cli.Command{command}
@@ -282,8 +392,9 @@ func TestApp_BeforeFunc(t *testing.T) {
 	app.Commands = []cli.Command{
 		cli.Command{
 			Name: "sub",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				subcommandRun = true
+				return nil
 			},
 		},
 	}
@@ -347,6 +458,42 @@ func TestAppHelpPrinter(t *testing.T) {
 	}
 }
 
+func TestAppHelpPrinter_Wrapped(t *testing.T) {
+	oldPrinter := cli.HelpPrinter
+	defer func() {
+		cli.HelpPrinter = oldPrinter
+	}()
+
+	calls := 0
+	cli.HelpPrinter = func(template string, data interface{}) {
+		calls++
+		oldPrinter(template, data)
+	}
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	app.Run([]string{"greet", "-h"})
+
+	expect(t, calls, 1)
+	if !strings.HasPrefix(out.String(), "NAME:\n   greet - ") {
+		t.Errorf("expected the default printer to write to the Writer, got %q", out.String())
+	}
+}
+
+func TestApp_RunContextActionError(t *testing.T) {
+	actionError := fmt.Errorf("action failed")
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "fail", Action: func(c *cli.Context) error { return actionError }},
+	}
+
+	ctx, err := app.RunContext([]string{"greet", "fail"})
+	expect(t, err, actionError)
+	refute(t, ctx, nil)
+}
+
 func TestAppCommandNotFound(t *testing.T) {
 	beforeRun, subcommandRun := false, false
 	app := cli.NewApp()
@@ -358,8 +505,9 @@ func TestAppCommandNotFound(t *testing.T) {
 	app.Commands = []cli.Command{
 		cli.Command{
 			Name: "bar",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				subcommandRun = true
+				return nil
 			},
 		},
 	}
@@ -369,3 +517,632 @@ func TestAppCommandNotFound(t *testing.T) {
 	expect(t, beforeRun, true)
 	expect(t, subcommandRun, false)
 }
+
+func TestApp_DryRun(t *testing.T) {
+	var dryRun bool
+
+	app := cli.NewApp()
+	app.EnableDryRun = true
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Subcommands: []cli.Command{
+				{
+					Name: "now",
+					Action: func(c *cli.Context) error {
+						dryRun = c.DryRun()
+						return nil
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "--dry-run", "deploy", "now"})
+	expect(t, err, nil)
+	expect(t, dryRun, true)
+
+	err = app.Run([]string{"command", "deploy", "now"})
+	expect(t, err, nil)
+	expect(t, dryRun, false)
+}
+
+func TestApp_AssumeYes(t *testing.T) {
+	var assumeYes bool
+
+	app := cli.NewApp()
+	app.EnableAssumeYes = true
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Subcommands: []cli.Command{
+				{
+					Name: "now",
+					Action: func(c *cli.Context) error {
+						assumeYes = c.AssumeYes()
+						return nil
+					},
+				},
+			},
+		},
+	}
+
+	for _, flag := range []string{"--yes", "--assume-yes"} {
+		assumeYes = false
+		err := app.Run([]string{"command", flag, "deploy", "now"})
+		expect(t, err, nil)
+		expect(t, assumeYes, true)
+	}
+
+	err := app.Run([]string{"command", "deploy", "now"})
+	expect(t, err, nil)
+	expect(t, assumeYes, false)
+}
+
+func TestApp_GlobalFlagOverride(t *testing.T) {
+	var region, source string
+
+	app := cli.NewApp()
+	app.Name = "myapp"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "region", Value: "us-east"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "region", Value: "eu-west"},
+			},
+			Subcommands: []cli.Command{
+				{
+					Name: "now",
+					Flags: []cli.Flag{
+						cli.BoolFlag{Name: "force"},
+					},
+					Action: func(c *cli.Context) error {
+						region = c.GlobalString("region")
+						source = c.FlagSource("region")
+						return nil
+					},
+				},
+			},
+		},
+	}
+
+	// child overrides parent
+	app.Run([]string{"myapp", "--region", "us-west", "deploy", "--region", "ap-south", "now"})
+	expect(t, region, "ap-south")
+	expect(t, source, "myapp deploy")
+
+	// inherited from the parent
+	app.Run([]string{"myapp", "--region", "us-west", "deploy", "now"})
+	expect(t, region, "us-west")
+	expect(t, source, "myapp")
+
+	// nearest default
+	app.Run([]string{"myapp", "deploy", "now"})
+	expect(t, region, "eu-west")
+	expect(t, source, "default")
+}
+
+func TestApp_BeforeCommand(t *testing.T) {
+	var hooked []string
+	added := false
+	denied := fmt.Errorf("not allowed to add")
+
+	app := cli.NewApp()
+	app.Name = "git"
+	app.BeforeCommand = func(c *cli.Context, command *cli.Command) error {
+		hooked = append(hooked, c.App.Name+" > "+command.Name)
+		if command.Name == "add" && c.Bool("deny") {
+			return denied
+		}
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "remote",
+			Flags: []cli.Flag{cli.BoolFlag{Name: "deny"}},
+			Subcommands: []cli.Command{
+				{
+					Name: "add",
+					Action: func(c *cli.Context) error {
+						added = true
+						return nil
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"git", "remote", "add"})
+	expect(t, err, nil)
+	expect(t, added, true)
+	expect(t, strings.Join(hooked, ", "), "git > remote, git remote > add")
+
+	hooked, added = nil, false
+	err = app.Run([]string{"git", "remote", "--deny", "add"})
+	expect(t, err, denied)
+	expect(t, added, false)
+	expect(t, len(hooked), 2)
+}
+
+func TestApp_AfterFunc(t *testing.T) {
+	var order []string
+	commandError := cli.NewExitError("command before failed", 2)
+	afterError := fmt.Errorf("after failed")
+
+	app := cli.NewApp()
+	app.Before = func(c *cli.Context) error {
+		order = append(order, "app before")
+		return nil
+	}
+	app.After = func(c *cli.Context) error {
+		order = append(order, "app after")
+		return afterError
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "sub",
+			Before: func(c *cli.Context) error {
+				order = append(order, "command before")
+				if c.Args().First() == "fail" {
+					return commandError
+				}
+				return nil
+			},
+			Action: func(c *cli.Context) error {
+				order = append(order, "command action")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "sub"})
+	expect(t, err, afterError)
+	expect(t, strings.Join(order, ", "), "app before, command before, command action, app after")
+
+	// the command error wins over the After error, but After still runs
+	order = nil
+	err = app.Run([]string{"command", "sub", "fail"})
+	expect(t, err, error(commandError))
+	expect(t, strings.Join(order, ", "), "app before, command before, app after")
+}
+
+func TestApp_AfterFuncActionError(t *testing.T) {
+	actionError := fmt.Errorf("action failed")
+	afterRan := false
+
+	app := cli.NewApp()
+	app.Action = func(c *cli.Context) error {
+		return actionError
+	}
+	app.After = func(c *cli.Context) error {
+		afterRan = true
+		return nil
+	}
+
+	err := app.Run([]string{"command"})
+	expect(t, err, actionError)
+	expect(t, afterRan, true)
+}
+
+func TestApp_AfterFuncBeforeFailure(t *testing.T) {
+	beforeError := fmt.Errorf("before failed")
+	afterRun, actionRun := false, false
+
+	app := cli.NewApp()
+	app.Before = func(c *cli.Context) error {
+		return beforeError
+	}
+	app.After = func(c *cli.Context) error {
+		afterRun = true
+		return nil
+	}
+	app.Action = func(c *cli.Context) error {
+		actionRun = true
+		return nil
+	}
+
+	err := app.Run([]string{"command"})
+	expect(t, err, beforeError)
+	expect(t, afterRun, true)
+	expect(t, actionRun, false)
+}
+
+func ExampleApp_Run_bashCompleteSubcommand() {
+	// set args for examples sake
+	os.Args = []string{"greet", "remote", "--generate-bash-completion"}
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.EnableBashCompletion = true
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					ShortName: "a",
+				}, {
+					Name: "remove",
+				}, {
+					Name:   "prune",
+					Hidden: true,
+				},
+			},
+		}, {
+			Name: "status",
+		},
+	}
+
+	app.Run(os.Args)
+	// Output:
+	// add
+	// a
+	// remove
+	// help
+	// h
+}
+
+func TestApp_Context(t *testing.T) {
+	type services struct {
+		name string
+	}
+	var received interface{}
+
+	app := cli.NewApp()
+	app.Context = &services{name: "api"}
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name: "add",
+					Action: func(c *cli.Context) error {
+						received = c.AppContext()
+						return nil
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "remote", "add"})
+	expect(t, err, nil)
+	expect(t, received, app.Context)
+	expect(t, received.(*services).name, "api")
+}
+
+var helpPositionTests = []struct {
+	args     []string
+	template string
+}{
+	{[]string{"app", "arg", "--help"}, cli.AppHelpTemplate},
+	{[]string{"app", "cmd", "--help"}, cli.CommandHelpTemplate},
+	{[]string{"app", "cmd", "arg", "-h"}, cli.CommandHelpTemplate},
+	{[]string{"app", "cmd", "--opt", "value", "arg", "--help"}, cli.CommandHelpTemplate},
+	{[]string{"app", "grp", "--help"}, cli.SubcommandHelpTemplate},
+	{[]string{"app", "grp", "arg", "--help"}, cli.SubcommandHelpTemplate},
+	{[]string{"app", "grp", "sub", "arg", "--help"}, cli.CommandHelpTemplate},
+}
+
+func TestApp_HelpAnyPosition(t *testing.T) {
+	oldPrinter := cli.HelpPrinter
+	defer func() {
+		cli.HelpPrinter = oldPrinter
+	}()
+
+	for _, test := range helpPositionTests {
+		printed := ""
+		cli.HelpPrinter = func(template string, data interface{}) {
+			printed = template
+		}
+
+		actionRun := false
+		action := func(c *cli.Context) error {
+			actionRun = true
+			return nil
+		}
+		app := cli.NewApp()
+		app.Action = action
+		app.Commands = []cli.Command{
+			{
+				Name:   "cmd",
+				Flags:  []cli.Flag{cli.StringFlag{Name: "opt"}},
+				Action: action,
+			}, {
+				Name: "grp",
+				Subcommands: []cli.Command{
+					{Name: "sub", Action: action},
+				},
+				Action: action,
+			},
+		}
+
+		err := app.Run(test.args)
+		expect(t, err, nil)
+		expect(t, actionRun, false)
+		if printed != test.template {
+			t.Errorf("%v did not print the expected help", test.args)
+		}
+	}
+}
+
+func TestApp_BuildVersion(t *testing.T) {
+	oldBuildVersion := cli.BuildVersion
+	defer func() {
+		cli.BuildVersion = oldBuildVersion
+	}()
+	cli.BuildVersion = func() string {
+		return "v1.4.0 (1a2b3c4d5e6f, 2024-01-02T15:04:05Z)"
+	}
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	err := app.Run([]string{"greet", "--version"})
+	expect(t, err, nil)
+	expect(t, out.String(), "greet version v1.4.0 (1a2b3c4d5e6f, 2024-01-02T15:04:05Z)\n")
+
+	out.Reset()
+	app = cli.NewApp()
+	app.Name = "greet"
+	app.Version = "2.0.0"
+	app.Writer = &out
+	err = app.Run([]string{"greet", "--version"})
+	expect(t, err, nil)
+	expect(t, out.String(), "greet version 2.0.0\n")
+
+	out.Reset()
+	cli.BuildVersion = func() string { return "" }
+	app = cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	err = app.Run([]string{"greet", "--version"})
+	expect(t, err, nil)
+	expect(t, out.String(), "greet version 0.0.0\n")
+}
+
+func TestCommandVersionFlagValue(t *testing.T) {
+	var out bytes.Buffer
+	var name string
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Version = "1.2.3"
+	app.Writer = &out
+	app.Commands = []cli.Command{
+		{
+			Name:  "hello",
+			Flags: []cli.Flag{cli.StringFlag{Name: "name"}},
+			Action: func(c *cli.Context) error {
+				name = c.String("name")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"greet", "hello", "--name", "-v"})
+	expect(t, err, nil)
+	expect(t, name, "-v")
+	expect(t, out.String(), "")
+
+	err = app.Run([]string{"greet", "hello", "--name", "x", "-v"})
+	expect(t, err, nil)
+	expect(t, out.String(), "greet version 1.2.3\n")
+}
+
+func ExampleApp_versionAfterArgs() {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Version = "1.2.3"
+	app.Commands = []cli.Command{
+		{
+			Name: "hello",
+			Action: func(c *cli.Context) error {
+				fmt.Println("hello")
+				return nil
+			},
+		},
+	}
+
+	app.Run([]string{"greet", "world", "--version"})
+	app.Run([]string{"greet", "hello", "world", "--version"})
+	app.Run([]string{"greet", "hello", "world", "--", "--version"})
+	// Output:
+	// greet version 1.2.3
+	// greet version 1.2.3
+	// hello
+}
+
+func ExampleCommand_ArgsComplete() {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.EnableBashCompletion = true
+	app.Commands = []cli.Command{
+		{
+			Name:  "cp",
+			Flags: []cli.Flag{cli.BoolFlag{Name: "force"}},
+			ArgsComplete: func(c *cli.Context) {
+				// complete sources first, then the destination
+				if len(c.Args()) == 0 {
+					fmt.Println("a.txt")
+					fmt.Println("b.txt")
+				} else {
+					fmt.Println("backup/")
+				}
+			},
+		},
+	}
+
+	app.Run([]string{"greet", "cp", "--generate-bash-completion"})
+	app.Run([]string{"greet", "cp", "--force", "a.txt", "--generate-bash-completion"})
+	// Output:
+	// a.txt
+	// b.txt
+	// backup/
+}
+
+func ExampleApp_RunContext() {
+	var out bytes.Buffer
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Version = "1.0.0"
+	app.Writer = &out
+	app.Commands = []cli.Command{
+		{
+			Name: "hello",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name", Value: "bob"},
+			},
+			Action: func(c *cli.Context) error {
+				fmt.Fprintln(c.App.Writer, "Hello,", c.String("name"))
+				return nil
+			},
+		},
+	}
+
+	ctx, err := app.RunContext([]string{"greet", "hello", "--name", "Jeremy", "extra"})
+	fmt.Println(err, ctx.String("name"), ctx.Args().First())
+
+	ctx, err = app.RunContext([]string{"greet", "--version"})
+	fmt.Println(err, ctx.Bool("version"))
+
+	fmt.Print(out.String())
+	// Output:
+	// <nil> Jeremy extra
+	// <nil> true
+	// Hello, Jeremy
+	// greet version 1.0.0
+}
+
+func TestApp_CompactUsageOnError(t *testing.T) {
+	run := func(compact bool) string {
+		var out bytes.Buffer
+		app := cli.NewApp()
+		app.Name = "myapp"
+		app.Writer = &out
+		app.CompactUsageOnError = compact
+		app.Commands = []cli.Command{
+			{
+				Name:      "deploy",
+				ArgsUsage: "<app>",
+				Action:    func(c *cli.Context) error { return nil },
+			},
+		}
+		err := app.Run([]string{"myapp", "deploy", "--bogus", "web"})
+		if _, ok := err.(*cli.ParseError); !ok {
+			t.Errorf("expected a ParseError, got %v", err)
+		}
+		return out.String()
+	}
+
+	compact := run(true)
+	expect(t, compact, "Incorrect Usage: unknown flag: --bogus\n"+
+		"Usage: myapp deploy [command options] <app>\n"+
+		"Run 'myapp deploy --help' for more information.\n")
+
+	full := run(false)
+	if !strings.Contains(full, "Incorrect Usage.") || !strings.Contains(full, "OPTIONS:") {
+		t.Errorf("expected the full help, got %q", full)
+	}
+	if !strings.Contains(full, "myapp deploy [command options] <app>") {
+		t.Errorf("expected ArgsUsage in the help synopsis, got %q", full)
+	}
+	if strings.Contains(compact, "OPTIONS:") {
+		t.Errorf("expected the compact usage to leave out the full help")
+	}
+}
+
+func TestApp_NameFromProgram(t *testing.T) {
+	oldArgs := os.Args
+	defer func() {
+		os.Args = oldArgs
+	}()
+	os.Args = []string{"/usr/local/bin/greet", "--help"}
+
+	var out bytes.Buffer
+	app := &cli.App{Writer: &out}
+	err := app.Run(os.Args)
+	expect(t, err, nil)
+	expect(t, app.Name, "greet")
+	expect(t, strings.Contains(out.String(), "   greet [global options] command"), true)
+
+	out.Reset()
+	app = &cli.App{Name: "hello", Writer: &out}
+	err = app.Run(os.Args)
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "   hello [global options] command"), true)
+
+	expect(t, cli.NewApp().Name, "greet")
+}
+
+func TestApp_NoAction(t *testing.T) {
+	var out bytes.Buffer
+	app := &cli.App{Name: "greet", Writer: &out}
+	err := app.Run([]string{"greet"})
+	expect(t, err, nil)
+	expect(t, strings.HasPrefix(out.String(), "NAME:\n   greet - \n"), true)
+	expect(t, strings.Contains(out.String(), "COMMANDS:"), true)
+
+	out.Reset()
+	app = &cli.App{Name: "greet", Writer: &out, NoActionExitCode: 3}
+	err = app.Run([]string{"greet"})
+	exitErr, ok := err.(cli.ExitCoder)
+	expect(t, ok, true)
+	expect(t, exitErr.ExitCode(), 3)
+	expect(t, strings.HasPrefix(out.String(), "NAME:"), true)
+
+	ran := false
+	app = &cli.App{Name: "greet", Writer: &out, Action: func(c *cli.Context) error {
+		ran = true
+		return nil
+	}}
+	err = app.Run([]string{"greet"})
+	expect(t, err, nil)
+	expect(t, ran, true)
+}
+
+func TestApp_PreprocessArgs(t *testing.T) {
+	var ran []string
+	aliases := map[string]string{"co": "checkout"}
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "checkout",
+			Action: func(c *cli.Context) error {
+				ran = append(ran, "checkout "+strings.Join(c.Args(), " "))
+				return nil
+			},
+		},
+	}
+	app.PreprocessArgs = cli.ChainPreprocessors(
+		func(args []string) ([]string, error) {
+			if len(args) > 0 && aliases[args[0]] != "" {
+				args[0] = aliases[args[0]]
+			}
+			return args, nil
+		},
+		func(args []string) ([]string, error) {
+			for _, arg := range args {
+				if arg == "--force-push" {
+					return nil, fmt.Errorf("refusing to %s", arg)
+				}
+			}
+			return args, nil
+		},
+	)
+
+	args := []string{"git", "co", "main"}
+	err := app.Run(args)
+	expect(t, err, nil)
+	expect(t, strings.Join(ran, ";"), "checkout main")
+	expect(t, args[1], "co")
+
+	err = app.Run([]string{"git", "co", "--force-push"})
+	expect(t, err.Error(), "refusing to --force-push")
+	expect(t, len(ran), 1)
+}
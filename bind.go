@@ -0,0 +1,104 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Creates flags for the exported fields of the struct v points to. Only fields
+// tagged `cli:"name,usage"` are used; the field's current value becomes the
+// flag's default, and parsing writes the flag's value back into the field.
+// Supported field types are string, int, int64, float64, bool, time.Duration,
+// []string and []int.
+func FlagsFromStruct(v interface{}) ([]Flag, error) {
+	ptr := reflect.ValueOf(v)
+	if ptr.Kind() != reflect.Ptr || ptr.IsNil() || ptr.Elem().Kind() != reflect.Struct {
+		return nil, errors.New("Expected a pointer to a struct")
+	}
+
+	var flags []Flag
+	val := ptr.Elem()
+	for i := 0; i < val.NumField(); i++ {
+		field := val.Type().Field(i)
+		tag := field.Tag.Get("cli")
+		if tag == "" || field.PkgPath != "" {
+			continue
+		}
+
+		parts := strings.SplitN(tag, ",", 2)
+		name := strings.TrimSpace(parts[0])
+		usage := ""
+		if len(parts) > 1 {
+			usage = strings.TrimSpace(parts[1])
+		}
+
+		f, err := bindField(name, usage, val.Field(i).Addr().Interface())
+		if err != nil {
+			return nil, fmt.Errorf("%s (field %s)", err, field.Name)
+		}
+		flags = append(flags, f)
+	}
+	return flags, nil
+}
+
+// Adds flags for the tagged fields of the struct v points to, see FlagsFromStruct
+func (a *App) RegisterStruct(v interface{}) error {
+	flags, err := FlagsFromStruct(v)
+	if err != nil {
+		return err
+	}
+	a.Flags = append(a.Flags, flags...)
+	return nil
+}
+
+// boundFlag is a flag that parses directly into a struct field
+type boundFlag struct {
+	Flag
+	usage string
+	ptr   interface{}
+}
+
+func bindField(name, usage string, ptr interface{}) (Flag, error) {
+	switch p := ptr.(type) {
+	case *string:
+		return boundFlag{StringFlag{name, *p, usage}, usage, p}, nil
+	case *int:
+		return boundFlag{IntFlag{name, *p, usage}, usage, p}, nil
+	case *int64:
+		return boundFlag{IntFlag{name, int(*p), usage}, usage, p}, nil
+	case *float64:
+		return boundFlag{Float64Flag{name, *p, usage}, usage, p}, nil
+	case *bool:
+		return boundFlag{BoolFlag{name, usage}, usage, p}, nil
+	case *time.Duration:
+		return boundFlag{StringFlag{name, p.String(), usage}, usage, p}, nil
+	case *[]string:
+		return StringSliceFlag{Name: name, Value: (*StringSlice)(p), Usage: usage}, nil
+	case *[]int:
+		return IntSliceFlag{Name: name, Value: (*IntSlice)(p), Usage: usage}, nil
+	}
+	return nil, fmt.Errorf("Unsupported type %s for flag %s", reflect.TypeOf(ptr).Elem(), name)
+}
+
+func (f boundFlag) Apply(set *flag.FlagSet) {
+	eachName(f.getName(), func(name string) {
+		switch p := f.ptr.(type) {
+		case *string:
+			set.StringVar(p, name, *p, f.usage)
+		case *int:
+			set.IntVar(p, name, *p, f.usage)
+		case *int64:
+			set.Int64Var(p, name, *p, f.usage)
+		case *float64:
+			set.Float64Var(p, name, *p, f.usage)
+		case *bool:
+			set.BoolVar(p, name, *p, f.usage)
+		case *time.Duration:
+			set.DurationVar(p, name, *p, f.usage)
+		}
+	})
+}
@@ -0,0 +1,72 @@
+package cli_test
+
+import (
+	"github.com/zenoss/cli"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type serverOptions struct {
+	Host     string        `cli:"host,the host to listen on"`
+	Port     int           `cli:"port,the port to listen on"`
+	MaxBytes int64         `cli:"max-bytes,the largest request body, in bytes"`
+	Ratio    float64       `cli:"ratio"`
+	Debug    bool          `cli:"debug,enable debugging"`
+	Timeout  time.Duration `cli:"timeout,how long to wait"`
+	Tags     []string      `cli:"tag,tags to apply"`
+	Ports    []int         `cli:"extra-port,more ports"`
+	Ignored  string
+	internal string `cli:"internal"`
+}
+
+func TestFlagsFromStruct(t *testing.T) {
+	opts := serverOptions{Host: "localhost", Port: 80}
+	flags, err := cli.FlagsFromStruct(&opts)
+	expect(t, err, nil)
+	expect(t, len(flags), 8)
+	expect(t, flags[0].String(), "--host 'localhost'\tthe host to listen on")
+	expect(t, flags[2].String(), "--max-bytes '0'\tthe largest request body, in bytes")
+}
+
+func TestApp_RegisterStruct(t *testing.T) {
+	opts := serverOptions{Host: "localhost", Port: 80, Timeout: time.Second}
+	var port int
+
+	app := cli.NewApp()
+	err := app.RegisterStruct(&opts)
+	expect(t, err, nil)
+	app.Action = func(c *cli.Context) error {
+		port = c.Int("port")
+		return nil
+	}
+
+	err = app.Run([]string{"server", "--port", "8080", "--max-bytes", "1048576", "--ratio", "0.5", "--debug",
+		"--timeout", "1m30s", "--tag", "a", "--tag", "b", "--extra-port", "9090"})
+	expect(t, err, nil)
+
+	expect(t, port, 8080)
+	expect(t, opts.Host, "localhost")
+	expect(t, opts.Port, 8080)
+	expect(t, opts.MaxBytes, int64(1048576))
+	expect(t, opts.Ratio, 0.5)
+	expect(t, opts.Debug, true)
+	expect(t, opts.Timeout, 90*time.Second)
+	if !reflect.DeepEqual(opts.Tags, []string{"a", "b"}) {
+		t.Errorf("%v does not match %v", opts.Tags, []string{"a", "b"})
+	}
+	if !reflect.DeepEqual(opts.Ports, []int{9090}) {
+		t.Errorf("%v does not match %v", opts.Ports, []int{9090})
+	}
+}
+
+func TestFlagsFromStruct_Unsupported(t *testing.T) {
+	opts := struct {
+		Weights map[string]int `cli:"weights"`
+	}{}
+	_, err := cli.FlagsFromStruct(&opts)
+	refute(t, err, nil)
+
+	_, err = cli.FlagsFromStruct(opts)
+	refute(t, err, nil)
+}
@@ -14,16 +14,18 @@ func Example() {
 			Name:      "add",
 			ShortName: "a",
 			Usage:     "add a task to the list",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				println("added task: ", c.Args().First())
+				return nil
 			},
 		},
 		{
 			Name:      "complete",
 			ShortName: "c",
 			Usage:     "complete a task on the list",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				println("completed task: ", c.Args().First())
+				return nil
 			},
 		},
 	}
@@ -49,8 +51,9 @@ func ExampleSubcommand() {
 					Flags: []cli.Flag{
 						cli.StringFlag{"name", "Bob", "Name of the person to greet"},
 					},
-					Action: func(c *cli.Context) {
+					Action: func(c *cli.Context) error {
 						println("Hello, ", c.String("name"))
+						return nil
 					},
 				}, {
 					Name:      "spanish",
@@ -59,8 +62,9 @@ func ExampleSubcommand() {
 					Flags: []cli.Flag{
 						cli.StringFlag{"surname", "Jones", "Surname of the person to greet"},
 					},
-					Action: func(c *cli.Context) {
+					Action: func(c *cli.Context) error {
 						println("Hola, ", c.String("surname"))
+						return nil
 					},
 				}, {
 					Name:      "french",
@@ -69,16 +73,18 @@ func ExampleSubcommand() {
 					Flags: []cli.Flag{
 						cli.StringFlag{"nickname", "Stevie", "Nickname of the person to greet"},
 					},
-					Action: func(c *cli.Context) {
+					Action: func(c *cli.Context) error {
 						println("Bonjour, ", c.String("nickname"))
+						return nil
 					},
 				},
 			},
 		}, {
 			Name:  "bye",
 			Usage: "says goodbye",
-			Action: func(c *cli.Context) {
+			Action: func(c *cli.Context) error {
 				println("bye")
+				return nil
 			},
 		},
 	}
@@ -1,41 +1,115 @@
 package cli
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"regexp"
 	"strings"
+	"time"
 )
 
+// The code a command exits with when its Timeout expires, following the
+// convention of timeout(1)
+const DefaultTimeoutExitCode = 124
+
 // Command is a subcommand for a cli.App.
 type Command struct {
 	// The name of the command
 	Name string
 	// short name of the command. Typically one character
+	// Deprecated: use Aliases instead
 	ShortName string
+	// Other names the command can be invoked by
+	Aliases []string
 	// A short description of the usage of this command
 	Usage string
 	// A longer explanation of how the command works
 	Description string
+	// The synopsis shown under USAGE in the help, replacing the generated one
+	UsageText string
+	// How the positional arguments are shown in the synopsis, such as "<app>".
+	// Defaults to "[arguments...]"
+	ArgsUsage string
 	// The function to call when checking for bash command completions
 	BashComplete func(context *Context)
+	// The function to call when completing a positional argument of the command.
+	// The arguments given so far are available from context.Args()
+	ArgsComplete func(context *Context)
 	// An action to execute before any sub-subcommands are run, but after the context is ready
 	// If a non-nil error is returned, no sub-subcommands are run
 	Before func(context *Context) error
-	// The function to call when this command is invoked
-	Action func(context *Context)
+	// The function to call when this command is invoked. Its error is returned
+	// from Run, wrap an action that returns nothing with ActionFunc
+	Action func(context *Context) error
 	// List of child commands
 	Subcommands []Command
+	// Run the Action with the arguments when the first one names none of the
+	// Subcommands, such as for "run <anything>". This is what a command with
+	// an Action does by default; the field states it explicitly.
+	TreatUnknownAsArgs bool
 	// List of flags to parse
 	Flags []Flag
 	// Treat all flags as normal arguments if true
 	SkipFlagParsing bool
+	// The function to check the positional arguments with before the action
+	// runs. Its error is reported as a usage error. Commands with Subcommands
+	// leave the checking to them.
+	ValidateArgs func(context *Context) error
+	// Leave the command out of help listings and completions if true
+	Hidden bool
+	// Reject positional arguments as a usage error, for commands that only
+	// take flags
+	NoArgs bool
+	// The name the positional arguments can be read under with
+	// Context.StringSlice, as though they were given to a slice flag
+	VariadicArg string
+	// Parse the arguments in the order given, stopping at the first positional
+	// argument like the flag package does, instead of moving flags given after
+	// positional arguments in front of them
+	StrictArgOrder bool
+	// Read arguments that are negative numbers, such as -3 or -0.5, as
+	// positional arguments rather than as flags
+	AllowNegativeNumberArgs bool
+	// The longest the command may run for. Once it expires the context from
+	// Context.StdContext is canceled and Run returns an ExitError. Zero means
+	// no limit.
+	Timeout time.Duration
+	// The code of the error returned when Timeout expires. Defaults to
+	// DefaultTimeoutExitCode
+	TimeoutExitCode int
+	// How many times the command is run again after failing with a Retryable
+	// error, such as one returned by Before or a subcommand
+	Retries int
+	// How long to wait before each retry
+	RetryDelay time.Duration
 }
 
 // Invokes the command given the context, parses ctx.Args() to generate command-specific flags
 func (c Command) Run(ctx *Context) error {
 
+	// a deprecation for the developer, not the user of the app
+	if c.ShortName != "" && ctx.App.Debug {
+		ctx.infof(ShortNameDeprecatedText+"\n", c.Name)
+	}
+
 	if len(c.Subcommands) > 0 || c.Before != nil {
-		return c.startApp(ctx)
+		var err error
+		if c.Timeout > 0 {
+			timed := *ctx
+			err = c.runWithTimeout(&timed, func() error {
+				return c.retry(&timed, func() error {
+					return c.startApp(&timed)
+				})
+			})
+		} else {
+			err = c.retry(ctx, func() error {
+				return c.startApp(ctx)
+			})
+		}
+		ctx.App.handleExitErr(ctx, err)
+		return err
 	}
 
 	// append help to flags
@@ -48,66 +122,393 @@ func (c Command) Run(ctx *Context) error {
 		c.Flags = append(c.Flags, BashCompletionFlag)
 	}
 
-	set := flagSet(c.Name, c.Flags)
+	set, err := flagSet(c.Name, c.Flags, ctx.App.BoolNegationPrefix)
+	if err != nil {
+		return err
+	}
 	set.SetOutput(ioutil.Discard)
 
+	// the version flag of the App, under the names no flag of the command has
+	var versionNames []string
+	eachName(VersionFlag.Name, func(name string) {
+		if set.Lookup(name) == nil {
+			set.Bool(name, false, "")
+			versionNames = append(versionNames, name)
+		}
+	})
+
+	// the completion flag is always last, even after positional args
+	args := ctx.rawArgs()
+	var completingValue *CompletedFlag
+	if ctx.App.EnableBashCompletion {
+		args, completingValue = splitValueCompletion(args, c.Flags)
+	}
+	completing := false
+	if ctx.App.EnableBashCompletion && len(args) > 1 && args[len(args)-1] == "--"+BashCompletionFlag.Name {
+		completing = true
+		args = append(Args{}, args[:len(args)-1]...)
+	}
+
+	// flags are only looked for before the "--" terminator
+	args, passthrough := splitPassthrough(args)
+
 	firstFlagIndex := -1
-	for index, arg := range ctx.Args() {
+	for index, arg := range args {
 		if strings.HasPrefix(arg, "-") {
 			firstFlagIndex = index
 			break
 		}
 	}
 
-	var err error
-	if firstFlagIndex > -1 && !c.SkipFlagParsing {
-		args := ctx.Args()
+	negativeNumbers := c.AllowNegativeNumberArgs && !c.SkipFlagParsing
+	input := args.Tail()
+	if firstFlagIndex > -1 && !c.SkipFlagParsing && !c.StrictArgOrder && !negativeNumbers {
 		regularArgs := args[1:firstFlagIndex]
 		flagArgs := args[firstFlagIndex:]
-		err = set.Parse(append(flagArgs, regularArgs...))
-	} else {
-		err = set.Parse(ctx.Args().Tail())
+		input = append(append([]string{}, flagArgs...), regularArgs...)
+	}
+	if passthrough != nil {
+		input = append(append(input, "--"), passthrough...)
+	}
+	var positional []string
+	if negativeNumbers {
+		input, positional = splitNegativeNumberArgs(input, set, c.StrictArgOrder)
+	}
+	if !c.SkipFlagParsing {
+		input = expandShortFlags(input, set)
+	}
+	err = set.Parse(input)
+	if err == nil && len(positional) > 0 {
+		// parsed after a "--" so that negative numbers are not read as flags
+		err = set.Parse(append([]string{"--"}, positional...))
+	}
+	input = append(input, positional...)
+	err = unknownFlagError(redactParseError(err, c.Flags), set, c.Flags)
+	nerr := normalizeFlags(c.Flags, set)
+
+	if (err != nil || nerr != nil) && ctx.App.CompactUsageOnError {
+		if err == nil {
+			err = nerr
+		}
+		showCompactUsage(ctx, err, commandSynopsis(ctx.App, c), c.path(ctx))
+		return &ParseError{Command: c.path(ctx), Err: err}
 	}
 
 	if err != nil {
-		fmt.Printf("Incorrect Usage.\n\n")
+		fmt.Fprintf(ctx.App.writer(), "%s.\n\n", IncorrectUsageText)
 		ShowCommandHelp(ctx, c.Name)
-		fmt.Println("")
-		return err
+		fmt.Fprintln(ctx.App.writer())
+		return &ParseError{Command: c.path(ctx), Err: err}
 	}
 
-	nerr := normalizeFlags(c.Flags, set)
 	if nerr != nil {
-		fmt.Println(nerr)
-		fmt.Println("")
+		fmt.Fprintln(ctx.App.writer(), nerr)
+		fmt.Fprintln(ctx.App.writer())
 		ShowCommandHelp(ctx, c.Name)
-		fmt.Println("")
-		return nerr
+		fmt.Fprintln(ctx.App.writer())
+		return &ParseError{Command: c.path(ctx), Err: nerr}
 	}
 	context := NewContext(ctx.App, set, ctx.globalSet)
+	context.parentContext = ctx
+	context.terminated = flagsTerminated(input, set)
+
+	if completingValue != nil {
+		completingValue.complete(context)
+		return nil
+	}
+
+	if completing {
+		ShowCommandCompletions(context, c.Name)
+		return nil
+	}
 
 	if checkCommandCompletions(context, c.Name) {
 		return nil
 	}
 
+	if !c.SkipFlagParsing && versionGiven(context, versionNames, !c.StrictArgOrder) {
+		root := ctx.lineage()
+		ShowVersion(root[len(root)-1])
+		return nil
+	}
+
 	if checkCommandHelp(context, c.Name) {
 		return nil
 	}
+
+	// help given after positional args
+	if !c.SkipFlagParsing && !c.StrictArgOrder && argsHaveFlag(context.Args(), HelpFlag, nil) {
+		ShowCommandHelp(ctx, c.Name)
+		return nil
+	}
+
+	if err := resolveFlags(c.Flags, context); err != nil {
+		return err
+	}
+
+	if err := c.prepareArgs(ctx, context); err != nil {
+		return err
+	}
+
+	// without an Action there is nothing to run but the help
+	if c.Action == nil {
+		ShowCommandHelp(ctx, c.Name)
+		return nil
+	}
+
+	context.markRan()
+	return ctx.App.runAction(context, func(context *Context) error {
+		action := func() error {
+			return c.retry(context, func() error {
+				return c.Action(context)
+			})
+		}
+		if c.Timeout > 0 {
+			return c.runWithTimeout(context, action)
+		}
+		return action()
+	})
+}
+
+// Sets up the context the Action of a command without subcommands is called
+// with, given ctx, the context of its App: the arguments are checked against
+// NoArgs and ValidateArgs, VariadicArg is defined, and with App.Debug set the
+// arguments naming sibling commands are warned about
+func (c Command) prepareArgs(ctx, context *Context) error {
+	if c.NoArgs && context.Args().Present() {
+		return c.usageError(ctx, fmt.Errorf(UnexpectedArgumentsText, strings.Join(context.Args(), " ")))
+	}
+	if c.VariadicArg != "" {
+		if context.flagSet.Lookup(c.VariadicArg) != nil {
+			return fmt.Errorf("Command %s: VariadicArg %q is already the name of a flag", c.Name, c.VariadicArg)
+		}
+		args := StringSlice(context.Args())
+		context.flagSet.Var(&args, c.VariadicArg, "")
+	}
+
 	context.Command = c
-	c.Action(context)
+	if c.ValidateArgs != nil {
+		if err := c.ValidateArgs(context); err != nil {
+			return c.usageError(ctx, err)
+		}
+	}
+	if ctx.App.Debug {
+		c.warnShadowedCommands(ctx, context)
+	}
 	return nil
 }
 
-// Returns true if Command.Name or Command.ShortName matches given name
+// Warns about the positional arguments of context that are also the names of
+// sibling commands in ctx, which may have been meant to run those commands
+// instead
+func (c Command) warnShadowedCommands(ctx, context *Context) {
+	for _, arg := range context.Args() {
+		if sibling := ctx.App.Command(arg); sibling != nil && !sibling.HasName(c.Name) {
+			ctx.infof("Warning: argument %q of %s is also the name of the command %q\n", arg, c.path(ctx), sibling.Name)
+		}
+	}
+}
+
+// Prints err along with the help of the command, or only its synopsis when
+// App.CompactUsageOnError is set, and returns it as a ParseError
+func (c Command) usageError(ctx *Context, err error) error {
+	if ctx.App.CompactUsageOnError {
+		showCompactUsage(ctx, err, commandSynopsis(ctx.App, c), c.path(ctx))
+	} else {
+		fmt.Fprintf(ctx.App.writer(), "%s: %v\n\n", IncorrectUsageText, err)
+		ShowCommandHelp(ctx, c.Name)
+		fmt.Fprintln(ctx.App.writer())
+	}
+	return &ParseError{Command: c.path(ctx), Err: err}
+}
+
+// Calls run until it succeeds, fails with an error that is not Retryable, or
+// has been retried Retries times, waiting RetryDelay before each retry
+func (c Command) retry(ctx *Context, run func() error) error {
+	err := run()
+	for attempt := 0; attempt < c.Retries && isRetryable(err); attempt++ {
+		select {
+		case <-time.After(c.RetryDelay):
+		case <-ctx.StdContext().Done():
+			return err
+		}
+		err = run()
+	}
+	return err
+}
+
+// Calls run with ctx carrying a context.Context that is canceled once the
+// Timeout expires. When run has not returned by then it is left to finish in
+// the background, and an ExitError is returned.
+func (c Command) runWithTimeout(ctx *Context, run func() error) error {
+	stdContext, cancel := context.WithTimeout(ctx.StdContext(), c.Timeout)
+	defer cancel()
+	ctx.stdContext = stdContext
+
+	done := make(chan error, 1)
+	go func() {
+		done <- run()
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-stdContext.Done():
+		code := c.TimeoutExitCode
+		if code == 0 {
+			code = DefaultTimeoutExitCode
+		}
+		return NewExitError(fmt.Sprintf(TimedOutText, c.path(ctx), c.Timeout), code)
+	}
+}
+
+// Whether one of names was parsed as a flag of context or, with afterArgs,
+// is given as a flag after its positional args
+func versionGiven(context *Context, names []string, afterArgs bool) bool {
+	for _, name := range names {
+		if context.Bool(name) {
+			return true
+		}
+		if !afterArgs {
+			continue
+		}
+		for _, arg := range context.Args() {
+			if arg == "--" {
+				break
+			}
+			if arg == "-"+name || arg == "--"+name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Matches the arguments AllowNegativeNumberArgs reads as positional
+var negativeNumber = regexp.MustCompile(`^-\d+(\.\d+)?$`)
+
+// Splits args into the flags, with their values, and the positional
+// arguments, counting negative numbers as positional. Flags given after
+// positional arguments are moved in front of them unless strict is set, and
+// what follows a "--" terminator is kept after the positional arguments, or
+// after the flags when there are none.
+func splitNegativeNumberArgs(args []string, set *flag.FlagSet, strict bool) (flags, positional []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			if len(positional) > 0 {
+				return flags, append(positional, args[i:]...)
+			}
+			return append(flags, args[i:]...), nil
+		case negativeNumber.MatchString(arg) || len(arg) < 2 || arg[0] != '-' || strict && len(positional) > 0:
+			positional = append(positional, arg)
+		default:
+			flags = append(flags, arg)
+			// the value of a flag given as "-name value" may be negative
+			name := strings.TrimLeft(arg, "-")
+			if f := set.Lookup(name); f != nil && !strings.Contains(name, "=") && !isBoolValue(f.Value) && i+1 < len(args) {
+				i++
+				flags = append(flags, args[i])
+			}
+		}
+	}
+	return flags, positional
+}
+
+// Appends a subcommand to the command. Add subcommands before adding the
+// command to its App, as App.Command returns a copy.
+func (c *Command) AddSubcommand(cmd Command) {
+	c.Subcommands = append(c.Subcommands, cmd)
+}
+
+// Reports whether the command only groups its subcommands: it has some and
+// no Action of its own. Run on its own, a group lists its subcommands.
+func (c Command) IsGroup() bool {
+	return len(c.Subcommands) > 0 && c.Action == nil
+}
+
+// Returns true if Command.Name, Command.ShortName or one of Command.Aliases matches given name.
+// The empty name matches no command.
 func (c Command) HasName(name string) bool {
-	return c.Name == name || c.ShortName == name
+	if name == "" {
+		return false
+	}
+	for _, n := range c.Names() {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the command followed by its ShortName and Aliases
+func (c Command) Names() []string {
+	names := []string{c.Name}
+	if c.ShortName != "" {
+		names = append(names, c.ShortName)
+	}
+	return append(names, c.Aliases...)
+}
+
+// Checks that every command, down to the subcommands, has a name and no
+// empty aliases, and that no two commands share a name or alias, which
+// would leave the later one unreachable by it. The commands are those of
+// parent, or of the App when parent is empty. The help command added to
+// them is left out: the commands take precedence over its names.
+func checkCommandNames(commands []Command, parent string) error {
+	owners := make(map[string]int)
+	for i, c := range commands {
+		if c.Name == helpCommand.Name && c.Usage == helpCommand.Usage {
+			// added by an earlier run
+			continue
+		}
+		if strings.TrimSpace(c.Name) == "" {
+			if parent != "" {
+				return fmt.Errorf("Command #%d of %s has no name", i+1, parent)
+			}
+			return fmt.Errorf("Command #%d has no name", i+1)
+		}
+		for _, alias := range c.Aliases {
+			if strings.TrimSpace(alias) == "" {
+				return fmt.Errorf("Command %s has an empty alias", c.Name)
+			}
+		}
+		if err := checkCommandNames(c.Subcommands, strings.TrimSpace(parent+" "+c.Name)); err != nil {
+			return err
+		}
+
+		for _, name := range c.Names() {
+			j, ok := owners[name]
+			if !ok {
+				owners[name] = i
+				continue
+			}
+			if j == i {
+				continue
+			}
+			owner := commands[j]
+			kind := "alias"
+			if name == owner.Name || name == c.Name {
+				kind = "name"
+			}
+			return fmt.Errorf("Command %s %q used by both %s and %s", kind, name, owner.Name, c.Name)
+		}
+	}
+	return nil
+}
+
+// Returns the full path of the command dispatched from ctx, such as
+// "git remote add"
+func (c Command) path(ctx *Context) string {
+	return fmt.Sprintf("%s %s", ctx.App.Name, c.Name)
 }
 
 func (c Command) startApp(ctx *Context) error {
 	app := NewApp()
 
 	// set the name and usage
-	app.Name = fmt.Sprintf("%s %s", ctx.App.Name, c.Name)
+	app.Name = c.path(ctx)
 	if c.Description != "" {
 		app.Usage = c.Description
 	} else {
@@ -120,16 +521,46 @@ func (c Command) startApp(ctx *Context) error {
 
 	// bash completion
 	app.EnableBashCompletion = ctx.App.EnableBashCompletion
+	app.CompactUsageOnError = ctx.App.CompactUsageOnError
+	app.BoolNegationPrefix = ctx.App.BoolNegationPrefix
+	app.EnvPrefix = ctx.App.EnvPrefix
+	app.UsePager = ctx.App.UsePager
+	app.Debug = ctx.App.Debug
+	app.Version = ctx.App.Version
+	app.UsageText = c.UsageText
+	app.negativeNumberArgs = c.AllowNegativeNumberArgs && len(c.Subcommands) == 0
 	if c.BashComplete != nil {
 		app.BashComplete = c.BashComplete
 	}
 
+	// application data
+	app.Context = ctx.App.Context
+
+	// output
+	app.Writer = ctx.App.Writer
+	app.Reader = ctx.App.Reader
+	app.Logger = ctx.App.Logger
+	// errors are left to the handler of ctx.App once the command is done
+	// retrying
+	app.ExitErrHandler = nil
+	app.BeforeCommand = ctx.App.BeforeCommand
+	app.ErrWriter = ctx.App.ErrWriter
+
 	// set the actions
 	app.Before = c.Before
-	if c.Action != nil {
-		app.Action = c.Action
-	} else {
+	if len(c.Subcommands) == 0 {
+		app.Before = func(context *Context) error {
+			if err := c.prepareArgs(ctx, context); err != nil {
+				return err
+			}
+			return c.Before(context)
+		}
+	}
+	if c.IsGroup() {
+		// a group run on its own lists its subcommands
 		app.Action = helpSubcommand.Action
+	} else {
+		app.Action = c.Action
 	}
 
 	return app.RunAsSubcommand(ctx)
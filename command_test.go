@@ -1,9 +1,15 @@
 package cli_test
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestCommandDoNotIgnoreFlags(t *testing.T) {
@@ -14,16 +20,16 @@ func TestCommandDoNotIgnoreFlags(t *testing.T) {
 
 	c := cli.NewContext(app, set, set)
 
-	command := cli.Command {
-		Name: "test-cmd",
-		ShortName: "tc",
-		Usage: "this is for testing",
+	command := cli.Command{
+		Name:        "test-cmd",
+		ShortName:   "tc",
+		Usage:       "this is for testing",
 		Description: "testing",
-		Action: func(_ *cli.Context) { },
+		Action:      func(_ *cli.Context) error { return nil },
 	}
 	err := command.Run(c)
 
-	expect(t, err.Error(), "flag provided but not defined: -break")
+	expect(t, err.Error(), "unknown flag: --break")
 }
 
 func TestCommandIgnoreFlags(t *testing.T) {
@@ -34,15 +40,666 @@ func TestCommandIgnoreFlags(t *testing.T) {
 
 	c := cli.NewContext(app, set, set)
 
-	command := cli.Command {
-		Name: "test-cmd",
-		ShortName: "tc",
-		Usage: "this is for testing",
-		Description: "testing",
-		Action: func(_ *cli.Context) { },
+	command := cli.Command{
+		Name:            "test-cmd",
+		ShortName:       "tc",
+		Usage:           "this is for testing",
+		Description:     "testing",
+		Action:          func(_ *cli.Context) error { return nil },
 		SkipFlagParsing: true,
 	}
 	err := command.Run(c)
 
 	expect(t, err, nil)
 }
+
+func TestCommandPassthroughArgs(t *testing.T) {
+	var args, passthrough cli.Args
+	var force bool
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:  "deploy",
+			Flags: []cli.Flag{cli.BoolFlag{Name: "force"}},
+			Action: func(c *cli.Context) error {
+				args = c.Args()
+				passthrough = c.PassthroughArgs()
+				force = c.Bool("force")
+				return nil
+			},
+		},
+	}
+
+	app.Run([]string{"app", "deploy", "app1", "--", "--force", "now"})
+	expect(t, strings.Join(args, " "), "app1")
+	expect(t, strings.Join(passthrough, " "), "--force now")
+	expect(t, force, false)
+
+	app.Run([]string{"app", "deploy", "--force", "--", "run", "now"})
+	expect(t, len(args), 0)
+	expect(t, strings.Join(passthrough, " "), "run now")
+	expect(t, force, true)
+
+	app.Run([]string{"app", "deploy", "app1", "--force"})
+	expect(t, strings.Join(args, " "), "app1")
+	expect(t, len(passthrough), 0)
+	expect(t, force, true)
+}
+
+func TestAppPassthroughArgs(t *testing.T) {
+	var args, passthrough cli.Args
+
+	app := cli.NewApp()
+	app.Action = func(c *cli.Context) error {
+		args = c.Args()
+		passthrough = c.PassthroughArgs()
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Action: func(c *cli.Context) error {
+				t.Errorf("command run from passthrough args")
+				return nil
+			},
+		},
+	}
+
+	app.Run([]string{"app", "--", "deploy", "now"})
+	expect(t, len(args), 0)
+	expect(t, strings.Join(passthrough, " "), "deploy now")
+
+	app.Run([]string{"app", "app1", "--", "deploy"})
+	expect(t, strings.Join(args, " "), "app1")
+	expect(t, strings.Join(passthrough, " "), "deploy")
+}
+
+func TestCommandTimeout(t *testing.T) {
+	canceled := make(chan bool, 1)
+	app := cli.NewApp()
+	app.Name = "run"
+	app.Commands = []cli.Command{
+		{
+			Name:            "slow",
+			Timeout:         10 * time.Millisecond,
+			TimeoutExitCode: 3,
+			Action: func(c *cli.Context) error {
+				select {
+				case <-c.StdContext().Done():
+					canceled <- true
+				case <-time.After(5 * time.Second):
+					canceled <- false
+				}
+				return nil
+			},
+		},
+		{
+			Name:    "fast",
+			Timeout: 5 * time.Second,
+			Action:  func(c *cli.Context) error { return nil },
+		},
+	}
+
+	err := app.Run([]string{"run", "slow"})
+	exitErr, ok := err.(cli.ExitCoder)
+	if !ok {
+		t.Fatalf("expected an ExitCoder, got %v", err)
+	}
+	expect(t, exitErr.ExitCode(), 3)
+	expect(t, err.Error(), "run slow timed out after 10ms")
+	expect(t, <-canceled, true)
+
+	err = app.Run([]string{"run", "fast"})
+	expect(t, err, nil)
+}
+
+type flakyError bool
+
+func (e flakyError) Error() string {
+	return "connection refused"
+}
+
+func (e flakyError) Retryable() bool {
+	return bool(e)
+}
+
+func TestCommandRetries(t *testing.T) {
+	attempts, runs := 0, 0
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:       "fetch",
+			Retries:    3,
+			RetryDelay: time.Millisecond,
+			Before: func(c *cli.Context) error {
+				attempts++
+				if attempts <= 2 {
+					return flakyError(true)
+				}
+				return nil
+			},
+			Action: func(c *cli.Context) error {
+				runs++
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "fetch"})
+	expect(t, err, nil)
+	expect(t, attempts, 3)
+	expect(t, runs, 1)
+}
+
+func TestCommandRetries_ActionError(t *testing.T) {
+	runs := 0
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:       "fetch",
+			Retries:    3,
+			RetryDelay: time.Millisecond,
+			Action: func(c *cli.Context) error {
+				runs++
+				if runs <= 2 {
+					return flakyError(true)
+				}
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "fetch"})
+	expect(t, err, nil)
+	expect(t, runs, 3)
+}
+
+func TestCommandRetries_NotRetryable(t *testing.T) {
+	attempts := 0
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:    "fetch",
+			Retries: 3,
+			Before: func(c *cli.Context) error {
+				attempts++
+				return flakyError(false)
+			},
+			Action: func(c *cli.Context) error { return nil },
+		},
+	}
+
+	err := app.Run([]string{"run", "fetch"})
+	expect(t, err, error(flakyError(false)))
+	expect(t, attempts, 1)
+}
+
+func TestCommandAliasConflicts(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "remove", Aliases: []string{"rm"}, Action: func(c *cli.Context) error { return nil }},
+		{Name: "purge", Aliases: []string{"p", "rm"}, Action: func(c *cli.Context) error { return nil }},
+	}
+	err := app.Run([]string{"run", "remove"})
+	expect(t, err.Error(), `Command alias "rm" used by both remove and purge`)
+
+	app.Commands = []cli.Command{
+		{Name: "list", Action: func(c *cli.Context) error { return nil }},
+		{Name: "ls", Aliases: []string{"list"}, Action: func(c *cli.Context) error { return nil }},
+	}
+	err = app.Run([]string{"run", "ls"})
+	expect(t, err.Error(), `Command name "list" used by both list and ls`)
+}
+
+func TestCommandShadowsHelp(t *testing.T) {
+	ran := ""
+	app := cli.NewApp()
+	app.Writer = ioutil.Discard
+	app.Commands = []cli.Command{
+		{Name: "history", Aliases: []string{"h"}, Action: func(c *cli.Context) error {
+			ran = "history"
+			return nil
+		}},
+	}
+	err := app.Run([]string{"run", "h"})
+	expect(t, err, nil)
+	expect(t, ran, "history")
+
+	err = app.Run([]string{"run", "help"})
+	expect(t, err, nil)
+}
+
+func TestSubcommandAliasConflicts(t *testing.T) {
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{Name: "remove", Aliases: []string{"rm"}, Action: func(c *cli.Context) error { return nil }},
+				{Name: "purge", Aliases: []string{"rm"}, Action: func(c *cli.Context) error { return nil }},
+			},
+		},
+	}
+	err := app.Run([]string{"run", "remote", "rm"})
+	expect(t, err.Error(), `Command alias "rm" used by both remove and purge`)
+}
+
+func TestCommandEmptyNames(t *testing.T) {
+	ran := false
+	action := func(c *cli.Context) error {
+		ran = true
+		return nil
+	}
+
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{Name: "list", Action: action},
+		{Usage: "a command without a name", Action: action},
+	}
+	err := app.Run([]string{"run", ""})
+	refute(t, err, nil)
+	expect(t, err.Error(), "Command #2 has no name")
+	expect(t, ran, false)
+
+	app.Commands = []cli.Command{
+		{Name: "list", Aliases: []string{"ls", ""}, Action: action},
+	}
+	err = app.Run([]string{"run", "list"})
+	expect(t, err.Error(), "Command list has an empty alias")
+
+	app.Commands = []cli.Command{
+		{
+			Name:        "remote",
+			Subcommands: []cli.Command{{Name: " ", Action: action}},
+		},
+	}
+	err = app.Run([]string{"run", "list"})
+	expect(t, err.Error(), "Command #1 of remote has no name")
+	expect(t, ran, false)
+
+	expect(t, cli.Command{}.HasName(""), false)
+}
+
+func TestCommandStrictArgOrder(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		var option string
+		var args []string
+		app := cli.NewApp()
+		app.Commands = []cli.Command{
+			{
+				Name:           "cmd",
+				StrictArgOrder: strict,
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "option"},
+				},
+				Action: func(c *cli.Context) error {
+					option = c.String("option")
+					args = c.Args()
+					return nil
+				},
+			},
+		}
+
+		err := app.Run([]string{"run", "cmd", "my-arg", "--option", "b"})
+		expect(t, err, nil)
+		if strict {
+			expect(t, option, "")
+			expect(t, strings.Join(args, " "), "my-arg --option b")
+		} else {
+			expect(t, option, "b")
+			expect(t, strings.Join(args, " "), "my-arg")
+		}
+	}
+}
+
+var negativeNumberArgsTests = []struct {
+	args     []string
+	expected string
+	decimals int
+}{
+	{[]string{"-3", "-5"}, "-3 -5", 0},
+	{[]string{"4", "-0.5", "-1.25"}, "4 -0.5 -1.25", 0},
+	{[]string{"-3", "--decimals", "2", "-5"}, "-3 -5", 2},
+	{[]string{"-3", "-5", "--", "-x"}, "-3 -5 -- -x", 0},
+}
+
+func TestCommandAllowNegativeNumberArgs(t *testing.T) {
+	for _, test := range negativeNumberArgsTests {
+		var args []string
+		decimals := 0
+		app := cli.NewApp()
+		app.Writer = ioutil.Discard
+		app.Commands = []cli.Command{
+			{
+				Name:                    "sum",
+				AllowNegativeNumberArgs: true,
+				Flags:                   []cli.Flag{cli.IntFlag{Name: "decimals"}},
+				Action: func(c *cli.Context) error {
+					args = c.Args()
+					if len(c.PassthroughArgs()) > 0 {
+						args = append(append(c.Args(), "--"), c.PassthroughArgs()...)
+					}
+					decimals = c.Int("decimals")
+					return nil
+				},
+			},
+		}
+
+		err := app.Run(append([]string{"run", "sum"}, test.args...))
+		expect(t, err, nil)
+		expect(t, strings.Join(args, " "), test.expected)
+		expect(t, decimals, test.decimals)
+	}
+}
+
+func TestCommandAllowNegativeNumberArgs_FlagValue(t *testing.T) {
+	var args []string
+	offset := 0
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:                    "shift",
+			AllowNegativeNumberArgs: true,
+			Flags:                   []cli.Flag{cli.IntFlag{Name: "offset"}},
+			Action: func(c *cli.Context) error {
+				args = c.Args()
+				offset = c.Int("offset")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "shift", "--offset", "-2", "-7"})
+	expect(t, err, nil)
+	expect(t, offset, -2)
+	expect(t, strings.Join(args, " "), "-7")
+}
+
+func TestCommandAllowNegativeNumberArgs_Before(t *testing.T) {
+	var args []string
+	offset := 0
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:                    "shift",
+			AllowNegativeNumberArgs: true,
+			Flags:                   []cli.Flag{cli.IntFlag{Name: "offset"}},
+			Before:                  func(c *cli.Context) error { return nil },
+			Action: func(c *cli.Context) error {
+				args = c.Args()
+				offset = c.Int("offset")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "shift", "--offset", "-2", "-7", "-0.5"})
+	expect(t, err, nil)
+	expect(t, offset, -2)
+	expect(t, strings.Join(args, " "), "-7 -0.5")
+
+	err = app.Run([]string{"run", "shift", "-3"})
+	expect(t, err, nil)
+	expect(t, offset, 0)
+	expect(t, strings.Join(args, " "), "-3")
+}
+
+func TestCommandNegativeNumberArgs_NotAllowed(t *testing.T) {
+	for _, args := range [][]string{{"-3", "-5"}, {"-0.5"}} {
+		app := cli.NewApp()
+		app.Writer = ioutil.Discard
+		app.Commands = []cli.Command{
+			{Name: "sum", Action: func(c *cli.Context) error { return nil }},
+		}
+
+		err := app.Run(append([]string{"run", "sum"}, args...))
+		refute(t, err, nil)
+		expect(t, strings.HasPrefix(err.Error(), "unknown flag: -"), true)
+	}
+}
+
+func TestCommandValidateArgs(t *testing.T) {
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+	validate := func(c *cli.Context) error {
+		if !uuid.MatchString(c.Args().First()) {
+			return fmt.Errorf("%q is not a valid UUID", c.Args().First())
+		}
+		return nil
+	}
+
+	for _, withBefore := range []bool{false, true} {
+		var out bytes.Buffer
+		ran := 0
+		app := cli.NewApp()
+		app.Writer = &out
+		command := cli.Command{
+			Name:         "show",
+			ValidateArgs: validate,
+			Action: func(c *cli.Context) error {
+				ran++
+				return nil
+			},
+		}
+		if withBefore {
+			command.Before = func(c *cli.Context) error { return nil }
+		}
+		app.Commands = []cli.Command{command}
+
+		err := app.Run([]string{"run", "show", "not-a-uuid"})
+		if _, ok := err.(*cli.ParseError); !ok {
+			t.Errorf("expected a ParseError, got %v", err)
+		}
+		expect(t, strings.HasPrefix(out.String(), "Incorrect Usage: \"not-a-uuid\" is not a valid UUID\n"), true)
+
+		err = app.Run([]string{"run", "show", "0f8fad5b-d9cb-469f-a165-70867728950e"})
+		expect(t, err, nil)
+		expect(t, ran, 1)
+	}
+}
+
+func TestCommandVariadicArg(t *testing.T) {
+	var files []string
+	var verbose bool
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:        "add",
+			VariadicArg: "files",
+			Flags:       []cli.Flag{cli.BoolFlag{Name: "verbose"}},
+			Action: func(c *cli.Context) error {
+				files = c.StringSlice("files")
+				verbose = c.Bool("verbose")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"git", "add", "--verbose", "a.go", "b.go", "c.go"})
+	expect(t, err, nil)
+	expect(t, strings.Join(files, " "), "a.go b.go c.go")
+	expect(t, verbose, true)
+
+	app.Commands[0].VariadicArg = "verbose"
+	err = app.Run([]string{"git", "add", "a.go"})
+	expect(t, err.Error(), `Command add: VariadicArg "verbose" is already the name of a flag`)
+}
+
+func TestCommandVariadicArg_Before(t *testing.T) {
+	var files, beforeFiles []string
+	var verbose bool
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:        "add",
+			VariadicArg: "files",
+			Flags:       []cli.Flag{cli.BoolFlag{Name: "verbose"}},
+			Before: func(c *cli.Context) error {
+				beforeFiles = c.StringSlice("files")
+				return nil
+			},
+			Action: func(c *cli.Context) error {
+				files = c.StringSlice("files")
+				verbose = c.Bool("verbose")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"git", "add", "--verbose", "a.go", "b.go"})
+	expect(t, err, nil)
+	expect(t, strings.Join(beforeFiles, " "), "a.go b.go")
+	expect(t, strings.Join(files, " "), "a.go b.go")
+	expect(t, verbose, true)
+}
+
+func TestCommandNoArgs(t *testing.T) {
+	var out bytes.Buffer
+	ran := false
+	app := cli.NewApp()
+	app.Writer = &out
+	app.Commands = []cli.Command{
+		{
+			Name:   "status",
+			NoArgs: true,
+			Flags:  []cli.Flag{cli.BoolFlag{Name: "short"}},
+			Action: func(c *cli.Context) error {
+				ran = true
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"git", "status", "--short", "foo", "bar"})
+	if _, ok := err.(*cli.ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+	expect(t, err.Error(), "unexpected arguments: foo bar")
+	expect(t, strings.HasPrefix(out.String(), "Incorrect Usage: unexpected arguments: foo bar\n"), true)
+	expect(t, ran, false)
+
+	err = app.Run([]string{"git", "status", "--short"})
+	expect(t, err, nil)
+	expect(t, ran, true)
+}
+
+func TestCommandNoArgs_Before(t *testing.T) {
+	ran := false
+	app := cli.NewApp()
+	app.Writer = ioutil.Discard
+	app.Commands = []cli.Command{
+		{
+			Name:   "status",
+			NoArgs: true,
+			Before: func(c *cli.Context) error { return nil },
+			Action: func(c *cli.Context) error {
+				ran = true
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"git", "status", "foo"})
+	if _, ok := err.(*cli.ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+	expect(t, ran, false)
+
+	err = app.Run([]string{"git", "status"})
+	expect(t, err, nil)
+	expect(t, ran, true)
+}
+
+func TestCommandGroup(t *testing.T) {
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "myapp"
+	app.Writer = &out
+	app.Commands = []cli.Command{
+		{
+			Name:  "remote",
+			Usage: "manage remotes",
+			Subcommands: []cli.Command{
+				{Name: "add", Usage: "add a remote", Action: func(c *cli.Context) error { return nil }},
+				{Name: "remove", Usage: "remove a remote", Action: func(c *cli.Context) error { return nil }},
+				{Name: "list", Usage: "list the remotes", Action: func(c *cli.Context) error { return nil }},
+			},
+		},
+		{
+			Name:   "status",
+			Before: func(c *cli.Context) error { return nil },
+		},
+		{
+			Name: "log",
+		},
+	}
+	expect(t, app.Commands[0].IsGroup(), true)
+	expect(t, app.Commands[1].IsGroup(), false)
+
+	err := app.Run([]string{"myapp", "remote"})
+	expect(t, err, nil)
+	for _, line := range []string{"add", "add a remote", "remove", "remove a remote", "list", "list the remotes"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("expected %q in the subcommand listing, got %q", line, out.String())
+		}
+	}
+
+	for _, name := range []string{"status", "log"} {
+		out.Reset()
+		err = app.Run([]string{"myapp", name})
+		expect(t, err, nil)
+		expect(t, strings.HasPrefix(out.String(), "NAME:\n   "+name), true)
+	}
+}
+
+func TestCommandUnknownSubcommandAsArgs(t *testing.T) {
+	var ran string
+	var args []string
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name:               "run",
+			TreatUnknownAsArgs: true,
+			Subcommands: []cli.Command{
+				{Name: "list", Action: func(c *cli.Context) error {
+					ran = "list"
+					return nil
+				}},
+			},
+			Action: func(c *cli.Context) error {
+				ran, args = "run", c.Args()
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"myapp", "run", "foo", "bar"})
+	expect(t, err, nil)
+	expect(t, ran, "run")
+	expect(t, strings.Join(args, " "), "foo bar")
+
+	err = app.Run([]string{"myapp", "run", "list"})
+	expect(t, err, nil)
+	expect(t, ran, "list")
+}
+
+func TestCommandUnknownSubcommandDefault(t *testing.T) {
+	var args []string
+	app := cli.NewApp()
+	app.Commands = []cli.Command{
+		{
+			Name: "run",
+			Subcommands: []cli.Command{
+				{Name: "list", Action: func(c *cli.Context) error { return nil }},
+			},
+			Action: func(c *cli.Context) error {
+				args = c.Args()
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"myapp", "run", "foo"})
+	expect(t, err, nil)
+	expect(t, strings.Join(args, " "), "foo")
+}
@@ -0,0 +1,528 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// The shells completion scripts can be generated for
+var CompletionShells = []string{"bash", "zsh", "fish"}
+
+// Returns the home directory of the current user. Completion scripts are
+// installed relative to this directory. Override it to install elsewhere.
+var HomeDir = func() (string, error) {
+	home := os.Getenv("HOME")
+	if home == "" {
+		return "", errors.New("Cannot determine home directory: $HOME is not set")
+	}
+	return home, nil
+}
+
+var completionScripts = map[string]string{
+	"bash": `#! /bin/bash
+
+_%[1]s_bash_autocomplete() {
+     local cur prev opts base
+     COMPREPLY=()
+     cur="${COMP_WORDS[COMP_CWORD]}"
+     prev="${COMP_WORDS[COMP_CWORD-1]}"
+%[3]s     opts=$( ${COMP_WORDS[@]:0:COMP_CWORD} --generate-bash-completion )
+     COMPREPLY=( $(compgen -W "${opts}" -- ${cur}) )
+     return 0
+ }
+
+ complete -F _%[1]s_bash_autocomplete %[2]s
+`,
+	"zsh": `#compdef %[2]s
+
+_%[1]s_zsh_autocomplete() {
+  local -a opts
+%[3]s  opts=("${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion)}")
+  _describe 'values' opts
+}
+
+compdef _%[1]s_zsh_autocomplete %[2]s
+`,
+	"fish": `complete -c %[2]s -f -a '(eval (commandline -opc) --generate-bash-completion)'
+%[3]s`,
+}
+
+// The completion of the values of one CompletedFlag in the scripts of each
+// shell, given the patterns its names are matched by and the candidates
+var valueCompletions = map[string]func(patterns []string, values string) string{
+	"bash": func(patterns []string, values string) string {
+		return fmt.Sprintf("     %s)\n          COMPREPLY=( $(compgen -W \"%s\" -- ${cur}) )\n          return 0\n          ;;\n", strings.Join(patterns, "|"), values)
+	},
+	"zsh": func(patterns []string, values string) string {
+		return fmt.Sprintf("    %s)\n      opts=(%s)\n      _describe 'values' opts\n      return\n      ;;\n", strings.Join(patterns, "|"), values)
+	},
+}
+
+// The candidates of a flag whose values are completed by calling back into
+// the program, in the script of each shell
+var valueCallbacks = map[string]string{
+	"bash": `$( ${COMP_WORDS[@]:0:COMP_CWORD} --generate-bash-completion )`,
+	"zsh":  `"${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion)}"`,
+	"fish": `(eval (commandline -opc) --generate-bash-completion)`,
+}
+
+// The start and end of the value completions in the script of each shell
+var valueCases = map[string][2]string{
+	"bash": {"     case \"${prev}\" in\n", "     esac\n"},
+	"zsh":  {"  case \"${words[CURRENT-1]}\" in\n", "  esac\n"},
+}
+
+// CompletedFlag completes the values of Flag in the shell. Values lists the
+// candidates, which the completion scripts inline, so they should be plain
+// words. CompletionFn instead prints candidates that depend on the live
+// program to the App's Writer, one per line like BashComplete; the scripts
+// call back into the program for them. Both need App.EnableBashCompletion.
+type CompletedFlag struct {
+	Flag
+	Values       []string
+	CompletionFn func(context *Context)
+}
+
+func (f CompletedFlag) wrapped() Flag {
+	return f.Flag
+}
+
+// Prints the candidates for the value of the flag
+func (f CompletedFlag) complete(c *Context) {
+	if f.CompletionFn != nil {
+		f.CompletionFn(c)
+		return
+	}
+	for _, value := range f.Values {
+		fmt.Fprintln(c.App.writer(), value)
+	}
+}
+
+// Returns the CompletedFlag f is or wraps
+func asCompletedFlag(f Flag) (CompletedFlag, bool) {
+	completed, ok := findFlag(f, func(f Flag) bool {
+		_, ok := f.(CompletedFlag)
+		return ok
+	}).(CompletedFlag)
+	return completed, ok
+}
+
+// Splits off the end of args when the completion scripts ask for the values
+// of one of the CompletedFlags among flags, by giving the bash completion flag
+// in place of its value. Returns the rest of args and the flag, or args and
+// nil when they do not.
+func splitValueCompletion(args []string, flags []Flag) ([]string, *CompletedFlag) {
+	n := len(args)
+	if n < 2 || args[n-1] != "--"+BashCompletionFlag.Name || !strings.HasPrefix(args[n-2], "-") {
+		return args, nil
+	}
+	given := strings.TrimLeft(args[n-2], "-")
+	for _, f := range flags {
+		completed, ok := asCompletedFlag(f)
+		if !ok {
+			continue
+		}
+		found := false
+		eachName(f.getName(), func(name string) {
+			found = found || name == given
+		})
+		if found {
+			return args[:n-2], &completed
+		}
+	}
+	return args, nil
+}
+
+// CompletionCommand prints or installs shell completion scripts for the App.
+// Add it to App.Commands and set App.EnableBashCompletion to use it:
+//
+//	app.Commands = append(app.Commands, cli.CompletionCommand)
+var CompletionCommand = Command{
+	Name:  "completion",
+	Usage: "Prints or installs shell completion scripts",
+	Description: "Prints the completion script for the given shell. With --install the script is written\n" +
+		"   to the shell's conventional completion location instead.",
+	Subcommands: []Command{
+		completionShellCommand("bash"),
+		completionShellCommand("zsh"),
+		completionShellCommand("fish"),
+		{
+			Name:  "install",
+			Usage: "Installs the completion script for the shell in $SHELL",
+			Action: func(c *Context) error {
+				shell := detectShell()
+				if shell == "" {
+					return fmt.Errorf(UndetectedShellText, strings.Join(CompletionShells, ", "))
+				}
+				return installCompletion(c, shell)
+			},
+		},
+	},
+}
+
+func completionShellCommand(shell string) Command {
+	return Command{
+		Name:  shell,
+		Usage: fmt.Sprintf("Prints the %s completion script", shell),
+		Flags: []Flag{
+			BoolFlag{"install", "write the script to the conventional location for " + shell},
+		},
+		Action: func(c *Context) error {
+			if c.Bool("install") {
+				return installCompletion(c, shell)
+			}
+			script, err := appCompletionScript(shell, c)
+			if err != nil {
+				return err
+			}
+			fmt.Fprint(c.App.writer(), script)
+			return nil
+		},
+	}
+}
+
+// Returns the completion script for the named shell and program
+func CompletionScript(shell, program string) (string, error) {
+	return completionScript(shell, program, nil)
+}
+
+// Returns the completion script for the named shell and the root App of c,
+// which completes the values of its CompletedFlags, and those of its
+// commands, in place
+func appCompletionScript(shell string, c *Context) (string, error) {
+	lineage := c.lineage()
+	root := lineage[len(lineage)-1].App
+	var flags []Flag
+	if root != nil {
+		flags = append(flags, root.Flags...)
+		flags = append(flags, commandFlags(root.Commands)...)
+	}
+	return completionScript(shell, programName(c), flags)
+}
+
+// Returns the flags of the commands and, recursively, of their subcommands
+func commandFlags(commands []Command) []Flag {
+	var flags []Flag
+	for _, c := range commands {
+		flags = append(flags, c.Flags...)
+		flags = append(flags, commandFlags(c.Subcommands)...)
+	}
+	return flags
+}
+
+// Returns the completion script for the named shell and program, with the
+// values of the CompletedFlags among flags completed in place: static Values
+// are inlined, and a CompletionFn is called back at completion time. The first
+// of several flags sharing a name wins.
+func completionScript(shell, program string, flags []Flag) (string, error) {
+	script, ok := completionScripts[shell]
+	if !ok {
+		return "", fmt.Errorf(UnsupportedShellText, shell)
+	}
+
+	var cases bytes.Buffer
+	seen := make(map[string]bool)
+	for _, f := range flags {
+		completed, ok := asCompletedFlag(f)
+		if !ok || hiddenFlag(f) || completed.CompletionFn == nil && len(completed.Values) == 0 {
+			continue
+		}
+		var names []string
+		eachName(f.getName(), func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		})
+		if len(names) == 0 {
+			continue
+		}
+
+		values := strings.Join(completed.Values, " ")
+		if completed.CompletionFn != nil {
+			values = valueCallbacks[shell]
+		}
+		if shell == "fish" {
+			fmt.Fprintf(&cases, "complete -c %s", program)
+			for _, name := range names {
+				if len(name) == 1 {
+					fmt.Fprintf(&cases, " -s %s", name)
+				} else {
+					fmt.Fprintf(&cases, " -l %s", name)
+				}
+			}
+			fmt.Fprintf(&cases, " -x -a '%s'\n", values)
+			continue
+		}
+		var patterns []string
+		for _, name := range names {
+			patterns = append(patterns, prefixFor(name)+name)
+		}
+		cases.WriteString(valueCompletions[shell](patterns, values))
+	}
+	if cases.Len() > 0 && shell != "fish" {
+		cases.WriteString(valueCases[shell][1])
+		return fmt.Sprintf(script, identifier(program), program, valueCases[shell][0]+cases.String()), nil
+	}
+	return fmt.Sprintf(script, identifier(program), program, cases.String()), nil
+}
+
+// Returns the conventional location of the completion script for the named
+// shell and program, relative to the HomeDir of the current user.
+func CompletionPath(shell, program string) (string, error) {
+	home, err := HomeDir()
+	if err != nil {
+		return "", err
+	}
+
+	switch shell {
+	case "bash":
+		return filepath.Join(home, ".bash_completion.d", program), nil
+	case "zsh":
+		return filepath.Join(home, ".zsh", "completions", "_"+program), nil
+	case "fish":
+		return filepath.Join(home, ".config", "fish", "completions", program+".fish"), nil
+	}
+
+	return "", fmt.Errorf(UnsupportedShellText, shell)
+}
+
+// Writes the completion script for shell to its CompletionPath and tells
+// the user how to enable it
+func installCompletion(c *Context, shell string) error {
+	program := programName(c)
+	path, err := CompletionPath(shell, program)
+	if err != nil {
+		return err
+	}
+	script, err := appCompletionScript(shell, c)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err == nil {
+		err = ioutil.WriteFile(path, []byte(script), 0644)
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.App.writer(), CompletionInstalledText+"\n", shell, program, path)
+	switch shell {
+	case "bash":
+		fmt.Fprintf(c.App.writer(), BashCompletionHintText+"\n", path)
+	case "zsh":
+		fmt.Fprintf(c.App.writer(), ZshCompletionHintText+"\n", filepath.Dir(path))
+	case "fish":
+		fmt.Fprintf(c.App.writer(), FishCompletionHintText+"\n", filepath.Dir(path))
+	}
+	return nil
+}
+
+// Returns the shell named by $SHELL, or "" if it is not a supported shell
+func detectShell() string {
+	shell := filepath.Base(os.Getenv("SHELL"))
+	for _, s := range CompletionShells {
+		if s == shell {
+			return s
+		}
+	}
+	return ""
+}
+
+// Prints the completion script for the shell in $SHELL, failing when it is
+// not one of CompletionShells
+func printShellCompletion(c *Context) error {
+	shell := detectShell()
+	if shell == "" {
+		return fmt.Errorf(UnsupportedShellEnvText, os.Getenv("SHELL"), strings.Join(CompletionShells, ", "))
+	}
+	script, err := appCompletionScript(shell, c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(c.App.writer(), script)
+	return nil
+}
+
+// Returns the name of the root program. Subcommand apps are named after the
+// full command path, so only the first word is kept.
+func programName(c *Context) string {
+	name := filepath.Base(os.Args[0])
+	if c.App != nil {
+		if fields := strings.Fields(c.App.Name); len(fields) > 0 {
+			name = filepath.Base(fields[0])
+		}
+	}
+	return name
+}
+
+// Returns program with characters that are not valid in shell function
+// names replaced by underscores
+func identifier(program string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' {
+			return r
+		}
+		return '_'
+	}, program)
+}
+
+// Returns the completion candidates for the command line args, which leave
+// out the program name and end with the word being completed, possibly "".
+// When that word starts with a dash the candidates are the flags of the
+// command it belongs to. Otherwise they are what the bash completion prints
+// for the preceding words. Only the candidates starting with the word are
+// returned, and custom completion functions must write to the App's Writer
+// for theirs to be included. The App is not run: its hooks are not called
+// and no config file is loaded.
+func (a *App) Completions(args []string) []string {
+	current := ""
+	if len(args) > 0 {
+		current = args[len(args)-1]
+		args = args[:len(args)-1]
+	}
+
+	var candidates []string
+	if strings.HasPrefix(current, "-") {
+		candidates = a.flagCompletions(args)
+	} else {
+		candidates = a.commandCompletions(args)
+	}
+
+	var matches []string
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// Returns what the bash completion prints for the command that args lead
+// to. The completion functions are called with contexts of the flags parsed
+// from args, on copies of the App and of the apps of commands with
+// subcommands that write to a buffer.
+func (a *App) commandCompletions(args []string) []string {
+	var out bytes.Buffer
+	copied := *a
+	app := &copied
+	app.Writer = &out
+	app.Commands = withHelpCommand(a.Commands)
+
+	context, ok := completionContext(app, app.Flags, args, nil)
+	for ok {
+		name := context.Args().First()
+		c := app.Command(name)
+		if c == nil || context.terminated {
+			ShowCompletions(context)
+			break
+		}
+		args = context.Args().Tail()
+
+		if len(c.Subcommands) == 0 {
+			if context, ok = completionContext(app, c.Flags, args, context); ok {
+				ShowCommandCompletions(context, c.Name)
+			}
+			break
+		}
+		app = &App{
+			Name:               c.Name,
+			Flags:              c.Flags,
+			Commands:           withHelpCommand(c.Subcommands),
+			BashComplete:       DefaultAppComplete,
+			BoolNegationPrefix: app.BoolNegationPrefix,
+			Context:            app.Context,
+			Writer:             &out,
+			ErrWriter:          app.ErrWriter,
+		}
+		if c.BashComplete != nil {
+			app.BashComplete = c.BashComplete
+		}
+		context, ok = completionContext(app, app.Flags, args, context)
+	}
+	return strings.Fields(out.String())
+}
+
+// Returns a context of flags parsed from args, or false when they do not
+// parse. Without a parent the context is the App's own, otherwise it is that
+// of a command of the App.
+func completionContext(app *App, flags []Flag, args []string, parent *Context) (*Context, bool) {
+	set, err := flagSet(app.Name, flags, app.BoolNegationPrefix)
+	if err != nil {
+		return nil, false
+	}
+	set.SetOutput(ioutil.Discard)
+	for _, f := range []Flag{HelpFlag, VersionFlag} {
+		if set.Lookup(firstName(f)) == nil {
+			f.Apply(set)
+		}
+	}
+	input := expandShortFlags(args, set)
+	if set.Parse(input) != nil || normalizeFlags(flags, set) != nil {
+		return nil, false
+	}
+
+	context := NewContext(app, set, set)
+	if parent != nil {
+		context.parentContext = parent
+		if app == parent.App {
+			context.globalSet = parent.globalSet
+		}
+	}
+	context.terminated = flagsTerminated(input, set)
+	return context, true
+}
+
+// Returns commands with the help command appended, unless one of them is
+// named like it, leaving commands alone
+func withHelpCommand(commands []Command) []Command {
+	commands = append([]Command{}, commands...)
+	for _, c := range commands {
+		if c.HasName(helpCommand.Name) {
+			return commands
+		}
+	}
+	return append(commands, helpCommand)
+}
+
+// Returns the flags, as they are given on the command line, of the command
+// that args lead to
+func (a *App) flagCompletions(args []string) []string {
+	flags := append([]Flag{}, a.Flags...)
+	flags = append(flags, VersionFlag)
+	commands := a.Commands
+	for _, arg := range args {
+		if arg == "--" {
+			return nil
+		}
+		for _, c := range commands {
+			if c.HasName(arg) {
+				flags, commands = c.Flags, c.Subcommands
+				break
+			}
+		}
+	}
+	flags = append(flags, HelpFlag)
+
+	var candidates []string
+	seen := make(map[string]bool)
+	for _, f := range flags {
+		if f == BashCompletionFlag || !onCommandLine(f) || hiddenFlag(f) {
+			continue
+		}
+		eachName(f.getName(), func(name string) {
+			if !seen[name] {
+				seen[name] = true
+				candidates = append(candidates, prefixFor(name)+name)
+			}
+		})
+	}
+	return candidates
+}
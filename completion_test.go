@@ -0,0 +1,271 @@
+package cli_test
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/zenoss/cli"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var completionPathTests = []struct {
+	shell    string
+	expected string
+}{
+	{"bash", "/home/test/.bash_completion.d/greet"},
+	{"zsh", "/home/test/.zsh/completions/_greet"},
+	{"fish", "/home/test/.config/fish/completions/greet.fish"},
+}
+
+func TestCompletionPath(t *testing.T) {
+	oldHomeDir := cli.HomeDir
+	defer func() {
+		cli.HomeDir = oldHomeDir
+	}()
+	cli.HomeDir = func() (string, error) {
+		return "/home/test", nil
+	}
+
+	for _, test := range completionPathTests {
+		path, err := cli.CompletionPath(test.shell, "greet")
+		expect(t, err, nil)
+		expect(t, path, filepath.FromSlash(test.expected))
+	}
+
+	_, err := cli.CompletionPath("tcsh", "greet")
+	refute(t, err, nil)
+}
+
+func TestCompletionPath_NoHome(t *testing.T) {
+	t.Setenv("HOME", "")
+
+	_, err := cli.CompletionPath("bash", "greet")
+	refute(t, err, nil)
+}
+
+func TestCompletionScript(t *testing.T) {
+	for _, shell := range cli.CompletionShells {
+		script, err := cli.CompletionScript(shell, "my-app")
+		expect(t, err, nil)
+		expect(t, strings.Contains(script, "my-app"), true)
+	}
+
+	_, err := cli.CompletionScript("tcsh", "greet")
+	refute(t, err, nil)
+}
+
+func TestCompletionCommand_Install(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("SHELL", "/usr/bin/fish")
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Commands = []cli.Command{cli.CompletionCommand}
+	err := app.Run([]string{"greet", "completion", "install"})
+	expect(t, err, nil)
+
+	path, _ := cli.CompletionPath("fish", "greet")
+	expect(t, strings.HasPrefix(path, home), true)
+	script, _ := cli.CompletionScript("fish", "greet")
+	contents, err := ioutil.ReadFile(path)
+	expect(t, err, nil)
+	expect(t, string(contents), script)
+}
+
+func TestCompletionCommand_InstallErrors(t *testing.T) {
+	t.Setenv("HOME", "")
+	t.Setenv("SHELL", "/bin/tcsh")
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = ioutil.Discard
+	app.Commands = []cli.Command{cli.CompletionCommand}
+
+	err := app.Run([]string{"greet", "completion", "install"})
+	expect(t, err.Error(), "Cannot detect shell from $SHELL, use one of: bash, zsh, fish")
+
+	err = app.Run([]string{"greet", "completion", "bash", "--install"})
+	expect(t, err.Error(), "Cannot determine home directory: $HOME is not set")
+}
+
+func TestCompletionFlag(t *testing.T) {
+	for _, shell := range cli.CompletionShells {
+		t.Setenv("SHELL", "/usr/local/bin/"+shell)
+
+		var out bytes.Buffer
+		app := cli.NewApp()
+		app.Name = "greet"
+		app.Writer = &out
+		app.EnableCompletionFlag = true
+		err := app.Run([]string{"greet", "--completion"})
+		expect(t, err, nil)
+
+		script, _ := cli.CompletionScript(shell, "greet")
+		expect(t, out.String(), script)
+	}
+}
+
+func TestCompletionFlag_UnsupportedShell(t *testing.T) {
+	t.Setenv("SHELL", "/bin/tcsh")
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	app.EnableCompletionFlag = true
+	err := app.Run([]string{"greet", "--completion"})
+	refute(t, err, nil)
+	expect(t, err.Error(), `Cannot print completion script for $SHELL "/bin/tcsh": expected one of bash, zsh, fish`)
+	expect(t, out.String(), "")
+}
+
+func valueCompletionApp(out *bytes.Buffer) *cli.App {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = out
+	app.EnableBashCompletion = true
+	app.Flags = []cli.Flag{
+		cli.CompletedFlag{Flag: cli.StringFlag{Name: "color, c"}, Values: []string{"always", "auto", "never"}},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "hello",
+			Flags: []cli.Flag{
+				cli.CompletedFlag{
+					Flag: cli.IntFlag{Name: "friend-id"},
+					CompletionFn: func(c *cli.Context) {
+						fmt.Fprintln(c.App.Writer, "1")
+						fmt.Fprintln(c.App.Writer, "42")
+					},
+				},
+			},
+			Action: func(c *cli.Context) error { return nil },
+		},
+		cli.CompletionCommand,
+	}
+	return app
+}
+
+func TestCompletionScript_ValueCompletions(t *testing.T) {
+	expected := map[string][]string{
+		"bash": {
+			"     --color|-c)\n          COMPREPLY=( $(compgen -W \"always auto never\" -- ${cur}) )",
+			"     --friend-id)\n          COMPREPLY=( $(compgen -W \"$( ${COMP_WORDS[@]:0:COMP_CWORD} --generate-bash-completion )\" -- ${cur}) )",
+		},
+		"zsh": {
+			"    --color|-c)\n      opts=(always auto never)",
+			"    --friend-id)\n      opts=(\"${(@f)$(${words[@]:0:#words[@]-1} --generate-bash-completion)}\")",
+		},
+		"fish": {
+			"complete -c greet -l color -s c -x -a 'always auto never'\n",
+			"complete -c greet -l friend-id -x -a '(eval (commandline -opc) --generate-bash-completion)'\n",
+		},
+	}
+	for _, shell := range cli.CompletionShells {
+		var out bytes.Buffer
+		err := valueCompletionApp(&out).Run([]string{"greet", "completion", shell})
+		expect(t, err, nil)
+		for _, part := range expected[shell] {
+			if !strings.Contains(out.String(), part) {
+				t.Errorf("%s script does not contain %q:\n%s", shell, part, out.String())
+			}
+		}
+	}
+}
+
+func TestCompletedFlag_Callback(t *testing.T) {
+	var out bytes.Buffer
+	err := valueCompletionApp(&out).Run([]string{"greet", "hello", "--friend-id", "--generate-bash-completion"})
+	expect(t, err, nil)
+	expect(t, out.String(), "1\n42\n")
+
+	out.Reset()
+	err = valueCompletionApp(&out).Run([]string{"greet", "-c", "--generate-bash-completion"})
+	expect(t, err, nil)
+	expect(t, out.String(), "always\nauto\nnever\n")
+}
+
+func TestCompletedFlag_Wrapped(t *testing.T) {
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.EnableBashCompletion = true
+	app.Writer = &out
+	app.Flags = []cli.Flag{
+		cli.SecretFlag{Flag: cli.CompletedFlag{Flag: cli.StringFlag{Name: "token"}, Values: []string{"abc", "def"}}},
+	}
+
+	err := app.Run([]string{"greet", "--token", "--generate-bash-completion"})
+	expect(t, err, nil)
+	expect(t, out.String(), "abc\ndef\n")
+}
+
+func completionsApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "lang, l", Value: "english"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:    "hello",
+			Aliases: []string{"hi"},
+			Flags:   []cli.Flag{cli.BoolFlag{Name: "loud"}},
+			Action:  func(c *cli.Context) error { return nil },
+		},
+		{
+			Name:   "goodbye",
+			Action: func(c *cli.Context) error { return nil },
+		},
+		{
+			Name:   "secret",
+			Hidden: true,
+			Action: func(c *cli.Context) error { return nil },
+		},
+	}
+	return app
+}
+
+func TestApp_CompletionsCommands(t *testing.T) {
+	app := completionsApp()
+	expect(t, strings.Join(app.Completions([]string{""}), " "), "hello hi goodbye help h")
+	expect(t, strings.Join(app.Completions([]string{"h"}), " "), "hello hi help h")
+	expect(t, strings.Join(app.Completions([]string{"--lang", "french", "go"}), " "), "goodbye")
+	expect(t, len(app.Completions([]string{"x"})), 0)
+}
+
+func TestApp_CompletionsDoNotRun(t *testing.T) {
+	app := completionsApp()
+	app.Before = func(c *cli.Context) error {
+		t.Error("Before should not run")
+		return nil
+	}
+	app.Commands = append(app.Commands, cli.Command{
+		Name: "remote",
+		Subcommands: []cli.Command{
+			{Name: "add"},
+			{
+				Name: "remove",
+				BashComplete: func(c *cli.Context) {
+					fmt.Fprintln(c.App.Writer, "origin", c.GlobalString("lang"))
+				},
+			},
+		},
+	})
+
+	expect(t, strings.Join(app.Completions([]string{"remote", ""}), " "), "add remove help h")
+	expect(t, strings.Join(app.Completions([]string{"-l", "fr", "remote", "remove", ""}), " "), "origin fr")
+	expect(t, len(app.Flags), 1)
+	expect(t, app.EnableBashCompletion, false)
+}
+
+func TestApp_CompletionsFlags(t *testing.T) {
+	app := completionsApp()
+	expect(t, strings.Join(app.Completions([]string{"-"}), " "), "--lang -l --version -v --help -h")
+	expect(t, strings.Join(app.Completions([]string{"--l"}), " "), "--lang")
+	expect(t, strings.Join(app.Completions([]string{"hello", "--"}), " "), "--loud --help")
+	expect(t, strings.Join(app.Completions([]string{"hi", "--lo"}), " "), "--loud")
+}
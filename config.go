@@ -0,0 +1,376 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// This flag names the config files to load flag values from, see
+// App.UseConfigFlag
+var ConfigFlag = StringSliceFlag{Name: "config", Usage: "load flag values from a JSON, YAML or TOML file, can be given more than once"}
+
+// Loads the files given with --config into the context, later files
+// overriding the keys of earlier ones
+func (c *Context) loadConfig() error {
+	f := c.flagSet.Lookup(ConfigFlag.Name)
+	if f == nil {
+		return nil
+	}
+	var paths []string
+	switch value := unwrapValue(f.Value).(type) {
+	case *StringSlice:
+		paths = value.Value()
+	default:
+		if value.String() != "" {
+			paths = []string{value.String()}
+		}
+	}
+
+	c.config = make(map[string][]string)
+	for _, path := range paths {
+		values, err := readConfig(path)
+		if err != nil {
+			return err
+		}
+		for key, value := range values {
+			c.config[key] = value
+		}
+	}
+	return nil
+}
+
+// Returns the config values loaded by the nearest level of the lineage
+func (c *Context) configValues() map[string][]string {
+	for _, ctx := range c.lineage() {
+		if ctx.config != nil {
+			return ctx.config
+		}
+	}
+	return nil
+}
+
+// Sets the flags that were given neither on the command line nor in the
+// environment from the loaded config files. A key matches a flag by any of
+// its names, and a list sets a slice flag once per item.
+func applyConfig(flags []Flag, ctx *Context) error {
+	config := ctx.configValues()
+	if len(config) == 0 {
+		return nil
+	}
+
+	for _, f := range flags {
+		if f.getName() == HelpFlag.Name || f.getName() == VersionFlag.Name || f.getName() == BashCompletionFlag.Name || f.getName() == ConfigFlag.Name {
+			continue
+		}
+		if _, ok := unwrapFlag(f).(AliasFlag); ok || fromEnv(f, ctx) {
+			continue
+		}
+
+		var names []string
+		given := false
+		key := ""
+		eachName(f.getName(), func(name string) {
+			names = append(names, name)
+			given = given || ctx.IsSet(name)
+			if _, ok := config[name]; ok && key == "" {
+				key = name
+			}
+		})
+		if given || key == "" {
+			continue
+		}
+
+		if err := setFlag(ctx.flagSet, names, config[key]); err != nil {
+			return fmt.Errorf(ConfigValueText, key, err)
+		}
+		ctx.setSource(names, "config")
+	}
+	return nil
+}
+
+// Returns whether the flag takes its value from an environment variable that
+// is set, either its own EnvVar or the one named after the App's EnvPrefix
+func fromEnv(f Flag, ctx *Context) bool {
+	if envVars := flagEnvVars(f); envVars != "" {
+		_, set := lookupEnv(envVars)
+		return set
+	}
+	if ctx.App == nil || ctx.App.EnvPrefix == "" {
+		return false
+	}
+	return os.Getenv(prefixedEnvVar(ctx.App.EnvPrefix, f.getName())) != ""
+}
+
+// Reads the flag values of a JSON, YAML or TOML config file, chosen by its
+// extension
+func readConfig(path string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string][]string
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		values, err = parseJSONConfig(data)
+	case ".yaml", ".yml":
+		values, err = parseYAMLConfig(data)
+	case ".toml":
+		values, err = parseTOMLConfig(data)
+	default:
+		return nil, fmt.Errorf(ConfigUnsupportedText, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf(ConfigReadText, path, err)
+	}
+	return values, nil
+}
+
+// Parses a JSON object whose values are strings, numbers, booleans or lists
+// of them
+func parseJSONConfig(data []byte) (map[string][]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var object map[string]interface{}
+	if err := decoder.Decode(&object); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string][]string)
+	for key, value := range object {
+		items, ok := value.([]interface{})
+		if !ok {
+			items = []interface{}{value}
+		}
+		for _, item := range items {
+			switch item.(type) {
+			case string, json.Number, bool:
+				values[key] = append(values[key], fmt.Sprint(item))
+			default:
+				return nil, fmt.Errorf("value of %q must be a string, number, boolean or a list of them", key)
+			}
+		}
+	}
+	return values, nil
+}
+
+// Parses the flat subset of YAML a config file needs: "key: value" lines,
+// lists given as "key: [a, b]" or as "- item" lines below the key, and
+// comments. Nested mappings are not supported.
+func parseYAMLConfig(data []byte) (map[string][]string, error) {
+	values := make(map[string][]string)
+	list := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "---" {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "- ") || trimmed == "-" {
+			if list == "" {
+				return nil, fmt.Errorf("line %d: list item without a key", i+1)
+			}
+			item, err := yamlScalar(strings.TrimPrefix(trimmed, "-"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			values[list] = append(values[list], item)
+			continue
+		}
+
+		if line != strings.TrimLeft(line, " \t") {
+			return nil, fmt.Errorf("line %d: nested mappings are not supported", i+1)
+		}
+		colon := strings.Index(trimmed, ":")
+		if colon <= 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", i+1)
+		}
+		key, err := yamlScalar(trimmed[:colon])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		value := strings.TrimSpace(trimmed[colon+1:])
+
+		list = ""
+		switch {
+		case value == "" || strings.HasPrefix(value, "#"):
+			list = key
+			values[key] = []string{}
+		case strings.HasPrefix(value, "["):
+			items, err := splitInlineList(value, "list")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			values[key] = []string{}
+			for _, item := range items {
+				item, err := yamlScalar(item)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %v", i+1, err)
+				}
+				values[key] = append(values[key], item)
+			}
+		default:
+			item, err := yamlScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			values[key] = []string{item}
+		}
+	}
+	return values, nil
+}
+
+// Parses the flat subset of TOML a config file needs: "key = value" lines
+// whose values are strings, numbers, booleans or arrays of them on one line,
+// and comments. Tables are not supported.
+func parseTOMLConfig(data []byte) (map[string][]string, error) {
+	values := make(map[string][]string)
+	for i, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", i+1)
+		}
+
+		equals := strings.Index(trimmed, "=")
+		if equals <= 0 {
+			return nil, fmt.Errorf("line %d: expected \"key = value\"", i+1)
+		}
+		key, err := tomlValue(trimmed[:equals])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		value := strings.TrimSpace(trimmed[equals+1:])
+
+		if !strings.HasPrefix(value, "[") {
+			item, err := tomlValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			values[key] = []string{item}
+			continue
+		}
+		items, err := splitInlineList(value, "array")
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		values[key] = []string{}
+		for _, item := range items {
+			if strings.TrimSpace(item) == "" {
+				continue
+			}
+			item, err := tomlValue(item)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", i+1, err)
+			}
+			values[key] = append(values[key], item)
+		}
+	}
+	return values, nil
+}
+
+// Splits a list given on one line, such as `["a,b", c] # comment`, into its
+// items, unparsed, at the commas outside quotes. Only a comment may follow
+// the closing bracket. kind names the list in errors.
+func splitInlineList(value, kind string) ([]string, error) {
+	var items []string
+	var quote byte
+	start := 1
+	for i := 1; i < len(value); i++ {
+		switch c := value[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ',':
+			items = append(items, value[start:i])
+			start = i + 1
+		case c == ']':
+			if last := value[start:i]; len(items) > 0 || strings.TrimSpace(last) != "" {
+				items = append(items, last)
+			}
+			if rest := strings.TrimSpace(value[i+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+				return nil, fmt.Errorf("unexpected %s after the %s", rest, kind)
+			}
+			return items, nil
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string in %s", value)
+	}
+	return nil, fmt.Errorf("unterminated %s", kind)
+}
+
+// Returns the string a TOML key or value stands for. Bare values such as
+// numbers and booleans are kept as they are, less a trailing comment. Only a
+// comment may follow a value.
+func tomlValue(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		quote, end := s[0], 0
+		for i := 1; i < len(s) && end == 0; i++ {
+			switch {
+			case s[i] == '\\' && quote == '"':
+				i++
+			case s[i] == quote:
+				end = i
+			}
+		}
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		if rest := strings.TrimSpace(s[end+1:]); rest != "" && !strings.HasPrefix(rest, "#") {
+			return "", fmt.Errorf("unexpected %s after %s", rest, s[:end+1])
+		}
+		if quote == '\'' {
+			return s[1:end], nil
+		}
+		return strconv.Unquote(s[:end+1])
+	}
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	if i := strings.IndexAny(s, " \t"); i >= 0 {
+		return "", fmt.Errorf("unexpected %s after %s", strings.TrimSpace(s[i:]), s[:i])
+	}
+	return s, nil
+}
+
+// Returns the string a YAML scalar stands for, unquoting it or dropping a
+// trailing comment
+func yamlScalar(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case strings.HasPrefix(s, `"`):
+		end := strings.LastIndex(s, `"`)
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strconv.Unquote(s[:end+1])
+	case strings.HasPrefix(s, "'"):
+		end := strings.LastIndex(s, "'")
+		if end == 0 {
+			return "", fmt.Errorf("unterminated string %s", s)
+		}
+		return strings.Replace(s[1:end], "''", "'", -1), nil
+	}
+	if i := strings.Index(s, " #"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	return s, nil
+}
@@ -0,0 +1,154 @@
+package cli_test
+
+import (
+	"github.com/codegangsta/cli"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func configApp(result *string) *cli.App {
+	app := cli.NewApp()
+	app.UseConfigFlag = true
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "host", Value: "localhost"},
+		cli.IntFlag{Name: "port", Value: 80},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "force, f"},
+				cli.StringSliceFlag{Name: "tag", Value: &cli.StringSlice{}},
+			},
+			Action: func(c *cli.Context) error {
+				*result = strings.Join([]string{
+					c.GlobalString("host"),
+					c.GlobalString("port"),
+					c.String("force"),
+					strings.Join(c.StringSlice("tag"), ","),
+				}, " ")
+				return nil
+			},
+		},
+	}
+	return app
+}
+
+func TestApp_ConfigFile(t *testing.T) {
+	config := writeConfig(t, "app.json", `{"host": "example.com", "port": 8080, "force": true, "tag": ["a", "b"]}`)
+
+	var result string
+	err := configApp(&result).Run([]string{"app", "--config", config, "deploy"})
+	expect(t, err, nil)
+	expect(t, result, "example.com 8080 true a,b")
+}
+
+func TestApp_ConfigFileMerge(t *testing.T) {
+	base := writeConfig(t, "base.yaml", `# shared settings
+host: example.com
+port: 8080
+tag:
+  - a
+  - b
+`)
+	local := writeConfig(t, "local.yml", `port: 9090 # just here
+tag: [c]
+f: true
+`)
+
+	var result string
+	err := configApp(&result).Run([]string{"app", "--config", base, "--config", local, "deploy"})
+	expect(t, err, nil)
+	expect(t, result, "example.com 9090 true c")
+}
+
+func TestApp_ConfigFileYAML_QuotedCommas(t *testing.T) {
+	config := writeConfig(t, "app.yaml", `tag: ["a,b", 'c, d', 'it''s, ok', e] # tags, split
+host: "x,y"
+`)
+
+	var result string
+	err := configApp(&result).Run([]string{"app", "--config", config, "deploy"})
+	expect(t, err, nil)
+	expect(t, result, `x,y 80 false a,b,c, d,it's, ok,e`)
+
+	err = configApp(&result).Run([]string{"app", "--config", writeConfig(t, "app.yaml", "tag: [a] junk\n"), "deploy"})
+	refute(t, err, nil)
+	expect(t, strings.HasSuffix(err.Error(), "line 1: unexpected junk after the list"), true)
+}
+
+func TestApp_ConfigFilePrecedence(t *testing.T) {
+	config := writeConfig(t, "app.json", `{"host": "example.com", "port": 8080, "tag": ["a"]}`)
+	t.Setenv("APP_PORT", "7070")
+
+	var result string
+	app := configApp(&result)
+	app.EnvPrefix = "APP"
+	err := app.Run([]string{"app", "--config", config, "--host", "cli.example.com", "deploy", "--tag", "x"})
+	expect(t, err, nil)
+	expect(t, result, "cli.example.com 7070 false x")
+}
+
+func TestApp_ConfigFileTOML(t *testing.T) {
+	config := writeConfig(t, "app.toml", `# deployment settings
+host = "example.com" # the server
+port = 8080
+force = true
+tag = ["a", 'b # c', "d\"e"]
+`)
+
+	var result string
+	err := configApp(&result).Run([]string{"app", "--config", config, "deploy"})
+	expect(t, err, nil)
+	expect(t, result, `example.com 8080 true a,b # c,d"e`)
+
+	err = configApp(&result).Run([]string{"app", "--config", writeConfig(t, "app.toml", "[server]\nport = 1\n"), "deploy"})
+	expect(t, strings.HasSuffix(err.Error(), "line 1: tables are not supported"), true)
+}
+
+func TestApp_ConfigFileTOML_QuotedCommas(t *testing.T) {
+	config := writeConfig(t, "app.toml", `tag = ["a,b", 'c, d', "e\",f", ] # tags, split
+host = 'x,y'
+`)
+
+	var result string
+	err := configApp(&result).Run([]string{"app", "--config", config, "deploy"})
+	expect(t, err, nil)
+	expect(t, result, `x,y 80 false a,b,c, d,e",f`)
+}
+
+func TestApp_ConfigFileTOML_TrailingText(t *testing.T) {
+	for _, line := range []string{`host = "a" junk`, `host = a junk`, `tag = ["a"] junk`, `tag = ["a" junk]`, `tag = ["a"`, `tag = ["a]`} {
+		var result string
+		err := configApp(&result).Run([]string{"app", "--config", writeConfig(t, "app.toml", line+"\n"), "deploy"})
+		if err == nil || !strings.Contains(err.Error(), "line 1: ") {
+			t.Errorf("%s: expected an error on line 1, got %v", line, err)
+		}
+		expect(t, result, "")
+	}
+}
+
+func TestApp_ConfigFileErrors(t *testing.T) {
+	var result string
+	app := configApp(&result)
+
+	err := app.Run([]string{"app", "--config", writeConfig(t, "app.ini", "port = 1"), "deploy"})
+	expect(t, strings.HasPrefix(err.Error(), "Unsupported config file"), true)
+
+	err = app.Run([]string{"app", "--config", writeConfig(t, "app.yaml", "server:\n  port: 1\n"), "deploy"})
+	expect(t, strings.HasSuffix(err.Error(), "line 2: nested mappings are not supported"), true)
+
+	err = app.Run([]string{"app", "--config", writeConfig(t, "app.json", `{"port": "many"}`), "deploy"})
+	expect(t, strings.HasPrefix(err.Error(), `invalid value for "port" in config`), true)
+	expect(t, result, "")
+}
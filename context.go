@@ -1,10 +1,17 @@
 package cli
 
 import (
-	"errors"
+	"context"
 	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Context is a type that is passed through to
@@ -12,16 +19,106 @@ import (
 // can be used to retrieve context-specific Args and
 // parsed command-line options.
 type Context struct {
-	App       *App
-	Command   Command
-	flagSet   *flag.FlagSet
-	globalSet *flag.FlagSet
-	setFlags  map[string]bool
+	App           *App
+	Command       Command
+	flagSet       *flag.FlagSet
+	globalSet     *flag.FlagSet
+	setFlags      map[string]bool
+	parentContext *Context
+	appContext    interface{}
+	terminated    bool
+	stdContext    context.Context
+	config        map[string][]string
+	// "env" or "config" by the names of the flags set from there
+	sources map[string]string
 }
 
 // Creates a new context. For use in when invoking an App or Command action.
 func NewContext(app *App, set *flag.FlagSet, globalSet *flag.FlagSet) *Context {
-	return &Context{App: app, flagSet: set, globalSet: globalSet}
+	c := &Context{App: app, flagSet: set, globalSet: globalSet}
+	if app != nil {
+		c.appContext = app.Context
+	}
+	return c
+}
+
+// Returns the application specific data set in App.Context
+func (c *Context) AppContext() interface{} {
+	return c.appContext
+}
+
+// Returns the local flag of the given name as the flag package defines it,
+// or nil if there is none. The name of an AliasFlag gives the flag it is an
+// alias of.
+func (c *Context) Lookup(name string) *flag.Flag {
+	return lookupFlag(name, c.flagSet)
+}
+
+// Returns every flag the command can be given: its own flags followed by
+// those it inherits from the levels above, nearest first. A flag sharing a
+// name with a nearer one is left out, so local flags take precedence. Hidden
+// flags are only included when includeHidden is set.
+func (c *Context) VisibleFlags(includeHidden bool) []Flag {
+	var flags []Flag
+	seen := make(map[string]bool)
+	add := func(fs []Flag) {
+		for _, f := range fs {
+			if f.getName() == BashCompletionFlag.Name || hiddenFlag(f) && !includeHidden {
+				continue
+			}
+			shadowed := false
+			eachName(f.getName(), func(name string) {
+				shadowed = shadowed || seen[name]
+			})
+			if shadowed {
+				continue
+			}
+			eachName(f.getName(), func(name string) {
+				seen[name] = true
+			})
+			flags = append(flags, f)
+		}
+	}
+
+	var app *App
+	for _, ctx := range c.lineage() {
+		add(ctx.Command.Flags)
+		if ctx.App != nil && ctx.App != app {
+			app = ctx.App
+			add(app.Flags)
+		}
+	}
+	return flags
+}
+
+// Returns the App's Writer, or os.Stdout when it has none, for actions to
+// write their output to
+func (c *Context) Writer() io.Writer {
+	if c.App == nil {
+		return os.Stdout
+	}
+	return c.App.writer()
+}
+
+// Returns the App's ErrWriter, or os.Stderr when it has none, for actions to
+// write errors and diagnostics to
+func (c *Context) ErrWriter() io.Writer {
+	if c.App == nil {
+		return os.Stderr
+	}
+	return c.App.errWriter()
+}
+
+// Returns the flag set the global flags were parsed into, for what the typed
+// lookups do not cover. Changing the set is at the caller's risk.
+func (c *Context) GlobalFlagSet() *flag.FlagSet {
+	return c.globalSet
+}
+
+// Returns the flag set the local flags were parsed into, for what the typed
+// lookups do not cover. Changing the set is at the caller's risk.
+func (c *Context) LocalFlagSet() *flag.FlagSet {
+	return c.flagSet
 }
 
 // Looks up the value of a local int flag, returns 0 if no int flag exists
@@ -34,6 +131,33 @@ func (c *Context) Float64(name string) float64 {
 	return lookupFloat64(name, c.flagSet)
 }
 
+// Looks up the value of a local int64 flag, returns 0 if no int64 flag exists
+func (c *Context) Int64(name string) int64 {
+	return lookupInt64(name, c.flagSet)
+}
+
+// Looks up the value of a local uint flag, returns 0 if no uint flag exists
+func (c *Context) Uint(name string) uint {
+	return lookupUint(name, c.flagSet)
+}
+
+// Looks up the value of a local uint64 flag, returns 0 if no uint64 flag exists
+func (c *Context) Uint64(name string) uint64 {
+	return lookupUint64(name, c.flagSet)
+}
+
+// Looks up the value of a local duration flag, returns 0 if no duration flag
+// exists. An unset flag has the default of its DurationFlag.
+func (c *Context) Duration(name string) time.Duration {
+	return lookupDuration(name, c.flagSet)
+}
+
+// Looks up the value of a local timestamp flag, returns the zero time if it is
+// not set or no timestamp flag exists
+func (c *Context) Timestamp(name string) time.Time {
+	return lookupTimestamp(name, c.flagSet)
+}
+
 // Looks up the value of a local bool flag, returns false if no bool flag exists
 func (c *Context) Bool(name string) bool {
 	return lookupBool(name, c.flagSet)
@@ -44,6 +168,12 @@ func (c *Context) BoolT(name string) bool {
 	return lookupBoolT(name, c.flagSet)
 }
 
+// Looks up how many times a local CountFlag was given, returns 0 if no
+// CountFlag exists
+func (c *Context) Count(name string) int {
+	return lookupCount(name, c.flagSet)
+}
+
 // Looks up the value of a local string flag, returns "" if no string flag exists
 func (c *Context) String(name string) string {
 	return lookupString(name, c.flagSet)
@@ -59,60 +189,460 @@ func (c *Context) IntSlice(name string) []int {
 	return lookupIntSlice(name, c.flagSet)
 }
 
+// Looks up the value of a local uint slice flag, returns nil if no uint slice flag exists
+func (c *Context) UintSlice(name string) []uint {
+	return lookupUintSlice(name, c.flagSet)
+}
+
+// Looks up the value of a local key=value slice flag, returns an empty slice if no key=value slice flag exists
+func (c *Context) KeyValueSlice(name string) []KeyValue {
+	return lookupKeyValueSlice(name, c.flagSet)
+}
+
+// Looks up the pairs of a local string map flag, returns an empty map if no string map flag exists
+func (c *Context) StringMap(name string) map[string]string {
+	return lookupStringMap(name, c.flagSet)
+}
+
 // Looks up the value of a local generic flag, returns nil if no generic flag exists
 func (c *Context) Generic(name string) interface{} {
 	return lookupGeneric(name, c.flagSet)
 }
 
+// Looks up the value of a local IP flag, returns nil if no IP flag exists
+func (c *Context) IP(name string) net.IP {
+	return lookupIP(name, c.flagSet)
+}
+
+// Looks up the value of a local ByteSize flag in bytes, returns 0 if no
+// ByteSize flag exists
+func (c *Context) ByteSize(name string) int64 {
+	return lookupByteSize(name, c.flagSet)
+}
+
+// Looks up the value of a local Percent flag, returns 0 if no Percent flag
+// exists
+func (c *Context) Percent(name string) float64 {
+	return lookupPercent(name, c.flagSet)
+}
+
+// Looks up the expanded value of a local Path flag, returns "" if no Path
+// flag exists
+func (c *Context) Path(name string) string {
+	return lookupPath(name, c.flagSet)
+}
+
+// Looks up the expanded values of a local PathSlice flag, returns nil if no
+// PathSlice flag exists
+func (c *Context) PathSlice(name string) []string {
+	return lookupPathSlice(name, c.flagSet)
+}
+
+// Looks up the value of a local IPNet flag, returns nil if no IPNet flag exists
+func (c *Context) IPNet(name string) *net.IPNet {
+	return lookupIPNet(name, c.flagSet)
+}
+
+// Looks up the value of a local URL flag, returns nil if no URL flag exists
+func (c *Context) URL(name string) *url.URL {
+	return lookupURL(name, c.flagSet)
+}
+
+// Looks up the values of a local EnumSlice flag, returns nil if no EnumSlice
+// flag exists
+func (c *Context) EnumSlice(name string) []string {
+	return lookupEnumSlice(name, c.flagSet)
+}
+
 // Looks up the value of a global int flag, returns 0 if no int flag exists
 func (c *Context) GlobalInt(name string) int {
-	return lookupInt(name, c.globalSet)
+	return lookupInt(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global float64 flag, returns 0 if no float64 flag exists
+func (c *Context) GlobalFloat64(name string) float64 {
+	return lookupFloat64(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global int64 flag, returns 0 if no int64 flag exists
+func (c *Context) GlobalInt64(name string) int64 {
+	return lookupInt64(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global uint flag, returns 0 if no uint flag exists
+func (c *Context) GlobalUint(name string) uint {
+	return lookupUint(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global uint64 flag, returns 0 if no uint64 flag exists
+func (c *Context) GlobalUint64(name string) uint64 {
+	return lookupUint64(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global duration flag, returns 0 if no duration flag
+// exists
+func (c *Context) GlobalDuration(name string) time.Duration {
+	return lookupDuration(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global timestamp flag, returns the zero time if it
+// is not set or no timestamp flag exists
+func (c *Context) GlobalTimestamp(name string) time.Time {
+	return lookupTimestamp(name, c.globalFlagSet(name))
 }
 
 // Looks up the value of a global bool flag, returns false if no bool flag exists
 func (c *Context) GlobalBool(name string) bool {
-	return lookupBool(name, c.globalSet)
+	return lookupBool(name, c.globalFlagSet(name))
 }
 
 // Looks up the value of a global string flag, returns "" if no string flag exists
 func (c *Context) GlobalString(name string) string {
-	return lookupString(name, c.globalSet)
+	return lookupString(name, c.globalFlagSet(name))
 }
 
 // Looks up the value of a global string slice flag, returns nil if no string slice flag exists
 func (c *Context) GlobalStringSlice(name string) []string {
-	return lookupStringSlice(name, c.globalSet)
+	return lookupStringSlice(name, c.globalFlagSet(name))
 }
 
 // Looks up the value of a global int slice flag, returns nil if no int slice flag exists
 func (c *Context) GlobalIntSlice(name string) []int {
-	return lookupIntSlice(name, c.globalSet)
+	return lookupIntSlice(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global uint slice flag, returns nil if no uint slice flag exists
+func (c *Context) GlobalUintSlice(name string) []uint {
+	return lookupUintSlice(name, c.globalFlagSet(name))
+}
+
+// Looks up the value of a global key=value slice flag, returns an empty slice if no key=value slice flag exists
+func (c *Context) GlobalKeyValueSlice(name string) []KeyValue {
+	return lookupKeyValueSlice(name, c.globalFlagSet(name))
+}
+
+// Looks up the pairs of a global string map flag, returns an empty map if no string map flag exists
+func (c *Context) GlobalStringMap(name string) map[string]string {
+	return lookupStringMap(name, c.globalFlagSet(name))
 }
 
 // Looks up the value of a global generic flag, returns nil if no generic flag exists
 func (c *Context) GlobalGeneric(name string) interface{} {
-	return lookupGeneric(name, c.globalSet)
+	return lookupGeneric(name, c.globalFlagSet(name))
+}
+
+// Opens the input named by a local flag. A value of "-" refers to standard
+// input, which is not closed when the returned reader is closed. Any other
+// value is opened as a file path.
+func (c *Context) OpenInput(name string) (io.ReadCloser, error) {
+	value := c.String(name)
+	switch value {
+	case "":
+		return nil, fmt.Errorf("No input given for flag: %s", name)
+	case "-":
+		return ioutil.NopCloser(os.Stdin), nil
+	}
+	file, err := os.Open(value)
+	if err != nil {
+		// a nil *os.File would make a non-nil io.ReadCloser
+		return nil, err
+	}
+	return file, nil
+}
+
+// Reports whether the --dry-run flag was given at any level of the command
+// line. The flag is only registered when App.EnableDryRun is set.
+func (c *Context) DryRun() bool {
+	for _, ctx := range c.lineage() {
+		if lookupBool(DryRunFlag.Name, ctx.flagSet) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the --quiet flag was given at any level of the command
+// line. The flag is only registered when App.EnableQuiet is set.
+func (c *Context) Quiet() bool {
+	for _, ctx := range c.lineage() {
+		if lookupBool(firstName(QuietFlag), ctx.flagSet) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the --yes flag was given at any level of the command line,
+// in which case prompts should not be shown and be answered yes. The flag is
+// only registered when App.EnableAssumeYes is set.
+func (c *Context) AssumeYes() bool {
+	for _, ctx := range c.lineage() {
+		if lookupBool(firstName(AssumeYesFlag), ctx.flagSet) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reports whether the conventional --output or -o flag asks for output other
+// than text, such as json, in which case actions should keep human-friendly
+// messages out of their output. The nearest level of the command line that
+// gave the flag wins, falling back to the default of the nearest level that
+// defines it. False when no level defines the flag.
+func (c *Context) IsMachineOutput() bool {
+	var output *flag.Flag
+	for _, ctx := range c.lineage() {
+		for _, name := range []string{"output", "o"} {
+			ff := lookupFlag(name, ctx.flagSet)
+			if ff == nil {
+				continue
+			}
+			if isFlagSet(ff.Name, ctx.flagSet) {
+				return machineOutput(ff.Value.String())
+			}
+			if output == nil {
+				output = ff
+			}
+		}
+	}
+	return output != nil && machineOutput(output.Value.String())
+}
+
+// Reports whether an --output format is meant for machines
+func machineOutput(format string) bool {
+	return format != "" && !strings.EqualFold(format, "text")
+}
+
+// Logs an informational message, such as a deprecation notice, unless the
+// --quiet flag was given
+func (c *Context) infof(format string, v ...interface{}) {
+	if !c.Quiet() {
+		c.App.logger().Printf(format, v...)
+	}
+}
+
+// Reports where the effective value of the named flag comes from: "cmdline"
+// when it was given on this command's line, the name of the App whose command
+// line it was given on when inherited from a parent level, "env" or "config"
+// when it was set from an environment variable or a config file, "default"
+// when it was not given at all, or "" when no such flag exists.
+func (c *Context) FlagSource(name string) string {
+	defined := false
+	for i, ctx := range c.lineage() {
+		if ctx.flagSet.Lookup(name) == nil {
+			continue
+		}
+		defined = true
+		if isFlagSet(name, ctx.flagSet) {
+			if i == 0 {
+				return "cmdline"
+			}
+			return ctx.App.Name
+		}
+		if source := ctx.sources[name]; source != "" {
+			return source
+		}
+	}
+
+	if defined {
+		return "default"
+	}
+	return ""
+}
+
+// Records where the flag with the given names was set from, see FlagSource
+func (c *Context) setSource(names []string, source string) {
+	if c.sources == nil {
+		c.sources = make(map[string]string)
+	}
+	for _, name := range names {
+		c.sources[name] = source
+	}
 }
 
-// Determines if the flag was actually set exists
+// Returns the flag set Global lookups of the named flag read from. A value
+// given on the command line of a child level overrides one given to a parent,
+// so the nearest level that set the flag wins. When no level set it, the
+// default of the nearest level that defines it is used.
+func (c *Context) globalFlagSet(name string) *flag.FlagSet {
+	sets := []*flag.FlagSet{c.globalSet}
+	for _, ctx := range c.lineage()[1:] {
+		sets = append(sets, ctx.flagSet)
+	}
+
+	var defined *flag.FlagSet
+	for _, set := range sets {
+		if set == nil || set.Lookup(name) == nil {
+			continue
+		}
+		if isFlagSet(name, set) {
+			return set
+		}
+		if defined == nil {
+			defined = set
+		}
+	}
+
+	if defined == nil {
+		return c.globalSet
+	}
+	return defined
+}
+
+// Returns the context.Context of the action, which is canceled when the
+// Timeout of its command expires. Defaults to context.Background().
+func (c *Context) StdContext() context.Context {
+	for _, cur := range c.lineage() {
+		if cur.stdContext != nil {
+			return cur.stdContext
+		}
+	}
+	return context.Background()
+}
+
+// Records c as the context the action ran with on the root App
+func (c *Context) markRan() {
+	lineage := c.lineage()
+	if root := lineage[len(lineage)-1].App; root != nil {
+		root.ranContext = c
+	}
+}
+
+// Returns this context followed by each of its parent contexts, ending
+// with the context of the root App
+func (c *Context) lineage() []*Context {
+	var lineage []*Context
+	for cur := c; cur != nil; cur = cur.parentContext {
+		lineage = append(lineage, cur)
+	}
+	return lineage
+}
+
+// Determines if the flag was actually set exists, by any of its names
 func (c *Context) IsSet(name string) bool {
 	if c.setFlags == nil {
 		c.setFlags = make(map[string]bool)
+		var shared []flag.Value
 		c.flagSet.Visit(func(f *flag.Flag) {
 			c.setFlags[f.Name] = true
+			if sharedValue(f.Value) {
+				shared = append(shared, unwrapValue(f.Value))
+			}
+		})
+		// the other names of a flag sharing its value were set along with it
+		c.flagSet.VisitAll(func(f *flag.Flag) {
+			for _, value := range shared {
+				if unwrapValue(f.Value) == value {
+					c.setFlags[f.Name] = true
+				}
+			}
 		})
 	}
 	return c.setFlags[name] == true
 }
 
+// Returns an error naming the flags when none of them was set, such as
+// "One of --file, --url or --stdin is required". A flag set to its zero
+// value on the command line counts as set.
+func (c *Context) RequireOneOf(names ...string) error {
+	for _, name := range names {
+		if c.IsSet(name) {
+			return nil
+		}
+	}
+
+	flags := make([]string, len(names))
+	for i, name := range names {
+		flags[i] = prefixFor(name) + name
+	}
+	switch len(flags) {
+	case 0:
+		return nil
+	case 1:
+		return fmt.Errorf(RequiredFlagText, flags[0])
+	}
+	return fmt.Errorf(RequiredOneOfText, strings.Join(flags[:len(flags)-1], ", "), flags[len(flags)-1])
+}
+
 type Args []string
 
-// Returns the command line arguments associated with the context.
+// Returns the command line arguments associated with the context. Arguments
+// after a "--" terminator are left out, see PassthroughArgs. The arguments
+// are a copy, which is safe to change.
 func (c *Context) Args() Args {
-	args := Args(c.flagSet.Args())
+	if c.Command.SkipFlagParsing {
+		return c.rawArgs()
+	}
+	args, _ := splitPassthrough(c.rawArgs())
 	return args
 }
 
+// Returns the arguments given after a "--" terminator, which are neither
+// parsed as flags nor dispatched to subcommands.
+func (c *Context) PassthroughArgs() Args {
+	_, passthrough := splitPassthrough(c.rawArgs())
+	if passthrough == nil {
+		return Args{}
+	}
+	return passthrough
+}
+
+// Parses every positional argument as an int. The error identifies the first
+// argument that is not an int.
+func (c *Context) IntArgs() ([]int, error) {
+	args := c.Args()
+	ints := make([]int, len(args))
+	for i, arg := range args {
+		n, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d %q is not an int", i+1, arg)
+		}
+		ints[i] = n
+	}
+	return ints, nil
+}
+
+// Parses every positional argument as a float64. The error identifies the
+// first argument that is not a number.
+func (c *Context) Float64Args() ([]float64, error) {
+	args := c.Args()
+	floats := make([]float64, len(args))
+	for i, arg := range args {
+		f, err := strconv.ParseFloat(arg, 64)
+		if err != nil {
+			return nil, fmt.Errorf("argument %d %q is not a number", i+1, arg)
+		}
+		floats[i] = f
+	}
+	return floats, nil
+}
+
+// Returns the arguments left over by the flag parser, including the "--"
+// terminator when the parser consumed it
+func (c *Context) rawArgs() Args {
+	if c.terminated {
+		return append(Args{"--"}, c.flagSet.Args()...)
+	}
+	return append(Args{}, c.flagSet.Args()...)
+}
+
+// Splits args at the first "--" terminator. The passthrough args are nil
+// when there is no terminator.
+func splitPassthrough(args Args) (Args, Args) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i], append(Args{}, args[i+1:]...)
+		}
+	}
+	return args, nil
+}
+
+// Reports whether parsing input with set stopped at a "--" terminator
+func flagsTerminated(input []string, set *flag.FlagSet) bool {
+	consumed := len(input) - set.NArg()
+	return consumed > 0 && input[consumed-1] == "--"
+}
+
 // Returns the nth argument, or else a blank string
 func (a Args) Get(n int) string {
 	if len(a) > n {
@@ -141,7 +671,7 @@ func (a Args) Present() bool {
 }
 
 func lookupInt(name string, set *flag.FlagSet) int {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
 		val, err := strconv.Atoi(f.Value.String())
 		if err != nil {
@@ -154,10 +684,31 @@ func lookupInt(name string, set *flag.FlagSet) int {
 }
 
 func lookupFloat64(name string, set *flag.FlagSet) float64 {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
-		val, err := strconv.ParseFloat(f.Value.String(), 64)
-		if err != nil {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return 0
+		}
+		val, ok := getter.Get().(float64)
+		if !ok {
+			return 0
+		}
+		return val
+	}
+
+	return 0
+}
+
+func lookupInt64(name string, set *flag.FlagSet) int64 {
+	f := lookupFlag(name, set)
+	if f != nil {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return 0
+		}
+		val, ok := getter.Get().(int64)
+		if !ok {
 			return 0
 		}
 		return val
@@ -166,8 +717,76 @@ func lookupFloat64(name string, set *flag.FlagSet) float64 {
 	return 0
 }
 
+func lookupUint(name string, set *flag.FlagSet) uint {
+	f := lookupFlag(name, set)
+	if f != nil {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return 0
+		}
+		val, ok := getter.Get().(uint)
+		if !ok {
+			return 0
+		}
+		return val
+	}
+
+	return 0
+}
+
+func lookupUint64(name string, set *flag.FlagSet) uint64 {
+	f := lookupFlag(name, set)
+	if f != nil {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return 0
+		}
+		val, ok := getter.Get().(uint64)
+		if !ok {
+			return 0
+		}
+		return val
+	}
+
+	return 0
+}
+
+func lookupDuration(name string, set *flag.FlagSet) time.Duration {
+	f := lookupFlag(name, set)
+	if f != nil {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return 0
+		}
+		val, ok := getter.Get().(time.Duration)
+		if !ok {
+			return 0
+		}
+		return val
+	}
+
+	return 0
+}
+
+func lookupTimestamp(name string, set *flag.FlagSet) time.Time {
+	f := lookupFlag(name, set)
+	if f != nil {
+		getter, ok := f.Value.(flag.Getter)
+		if !ok {
+			return time.Time{}
+		}
+		val, ok := getter.Get().(time.Time)
+		if !ok {
+			return time.Time{}
+		}
+		return val
+	}
+
+	return time.Time{}
+}
+
 func lookupString(name string, set *flag.FlagSet) string {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
 		return f.Value.String()
 	}
@@ -176,9 +795,9 @@ func lookupString(name string, set *flag.FlagSet) string {
 }
 
 func lookupStringSlice(name string, set *flag.FlagSet) []string {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
-		return (f.Value.(*StringSlice)).Value()
+		return (unwrapValue(f.Value).(*StringSlice)).Value()
 
 	}
 
@@ -186,25 +805,151 @@ func lookupStringSlice(name string, set *flag.FlagSet) []string {
 }
 
 func lookupIntSlice(name string, set *flag.FlagSet) []int {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
-		return (f.Value.(*IntSlice)).Value()
+		return (unwrapValue(f.Value).(*IntSlice)).Value()
 
 	}
 
 	return nil
 }
 
-func lookupGeneric(name string, set *flag.FlagSet) interface{} {
+func lookupUintSlice(name string, set *flag.FlagSet) []uint {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if slice, ok := unwrapValue(f.Value).(*UintSlice); ok {
+			return slice.Value()
+		}
+	}
+
+	return nil
+}
+
+func lookupKeyValueSlice(name string, set *flag.FlagSet) []KeyValue {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if slice, ok := unwrapValue(f.Value).(*KeyValueSlice); ok {
+			return slice.Value()
+		}
+	}
+
+	return []KeyValue{}
+}
+
+func lookupStringMap(name string, set *flag.FlagSet) map[string]string {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if m, ok := unwrapValue(f.Value).(*StringMap); ok {
+			return m.Value()
+		}
+	}
+
+	return map[string]string{}
+}
+
+// Looks up the named flag of set, or the flag it is an alias of when it is
+// the name of an AliasFlag
+func lookupFlag(name string, set *flag.FlagSet) *flag.Flag {
 	f := set.Lookup(name)
+	if f == nil {
+		return nil
+	}
+	if alias, ok := unwrapValue(f.Value).(*aliasValue); ok {
+		return alias.set.Lookup(alias.name)
+	}
+	return f
+}
+
+func lookupGeneric(name string, set *flag.FlagSet) interface{} {
+	f := lookupFlag(name, set)
 	if f != nil {
 		return f.Value
 	}
 	return nil
 }
 
+func lookupIP(name string, set *flag.FlagSet) net.IP {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if ip, ok := unwrapValue(f.Value).(*IP); ok {
+			return ip.Value()
+		}
+	}
+	return nil
+}
+
+func lookupByteSize(name string, set *flag.FlagSet) int64 {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if size, ok := unwrapValue(f.Value).(*ByteSize); ok {
+			return size.Value()
+		}
+	}
+	return 0
+}
+
+func lookupPercent(name string, set *flag.FlagSet) float64 {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if percent, ok := unwrapValue(f.Value).(*Percent); ok {
+			return percent.Value()
+		}
+	}
+	return 0
+}
+
+func lookupPath(name string, set *flag.FlagSet) string {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if path, ok := unwrapValue(f.Value).(*Path); ok {
+			return path.Value()
+		}
+	}
+	return ""
+}
+
+func lookupPathSlice(name string, set *flag.FlagSet) []string {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if slice, ok := unwrapValue(f.Value).(*PathSlice); ok {
+			return slice.Value()
+		}
+	}
+	return nil
+}
+
+func lookupIPNet(name string, set *flag.FlagSet) *net.IPNet {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if ipnet, ok := unwrapValue(f.Value).(*IPNet); ok {
+			return ipnet.Value()
+		}
+	}
+	return nil
+}
+
+func lookupURL(name string, set *flag.FlagSet) *url.URL {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if u, ok := unwrapValue(f.Value).(*URL); ok {
+			return u.Value()
+		}
+	}
+	return nil
+}
+
+func lookupEnumSlice(name string, set *flag.FlagSet) []string {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if slice, ok := unwrapValue(f.Value).(*EnumSlice); ok {
+			return slice.Value()
+		}
+	}
+	return nil
+}
+
 func lookupBool(name string, set *flag.FlagSet) bool {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
 		val, err := strconv.ParseBool(f.Value.String())
 		if err != nil {
@@ -216,8 +961,18 @@ func lookupBool(name string, set *flag.FlagSet) bool {
 	return false
 }
 
+func lookupCount(name string, set *flag.FlagSet) int {
+	f := lookupFlag(name, set)
+	if f != nil {
+		if count, ok := unwrapValue(f.Value).(*counter); ok {
+			return int(*count)
+		}
+	}
+	return 0
+}
+
 func lookupBoolT(name string, set *flag.FlagSet) bool {
-	f := set.Lookup(name)
+	f := lookupFlag(name, set)
 	if f != nil {
 		val, err := strconv.ParseBool(f.Value.String())
 		if err != nil {
@@ -229,12 +984,38 @@ func lookupBoolT(name string, set *flag.FlagSet) bool {
 	return false
 }
 
+func isFlagSet(name string, set *flag.FlagSet) bool {
+	found := false
+	set.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
 func copyFlag(name string, ff *flag.Flag, set *flag.FlagSet) {
-	switch ff.Value.(type) {
-	case *StringSlice:
-	default:
-		set.Set(name, ff.Value.String())
+	if sharedValue(ff.Value) {
+		return
+	}
+	// the value was normalized when given, so it is copied as it is
+	if target := set.Lookup(name); target != nil {
+		if normalized, ok := target.Value.(*normalizedValue); ok {
+			target.Value = normalized.Value
+			defer func() { target.Value = normalized }()
+		}
 	}
+	set.Set(name, ff.Value.String())
+}
+
+// Returns whether all the names of a flag share its value, so setting it by
+// one name sets it by all of them and there is nothing to copy
+func sharedValue(value flag.Value) bool {
+	switch unwrapValue(value).(type) {
+	case *StringSlice, *IntSlice, *UintSlice, *KeyValueSlice, *StringMap, *PathSlice, *EnumSlice, *timestamp, *counter:
+		return true
+	}
+	return false
 }
 
 func normalizeFlags(flags []Flag, set *flag.FlagSet) error {
@@ -252,7 +1033,11 @@ func normalizeFlags(flags []Flag, set *flag.FlagSet) error {
 			name = strings.Trim(name, " ")
 			if visited[name] {
 				if ff != nil {
-					return errors.New("Cannot use two forms of the same flag: " + name + " " + ff.Name)
+					// the names of a slice or count flag add to one value
+					if sharedValue(ff.Value) {
+						continue
+					}
+					return fmt.Errorf(TwoFormsText, name, ff.Name)
 				}
 				ff = set.Lookup(name)
 			}
@@ -1,8 +1,16 @@
 package cli_test
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
 	"github.com/codegangsta/cli"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -19,6 +27,22 @@ func TestNewContext(t *testing.T) {
 	expect(t, c.Command.Name, "mycommand")
 }
 
+func TestContext_FlagSets(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Int("myflag", 12, "doc")
+	globalSet := flag.NewFlagSet("test", 0)
+	globalSet.Bool("verbose", false, "doc")
+	c := cli.NewContext(nil, set, globalSet)
+	globalSet.Parse([]string{"--verbose", "cmd"})
+	set.Parse([]string{"--myflag", "5", "arg"})
+
+	expect(t, c.LocalFlagSet().Lookup("myflag").Value.String(), "5")
+	expect(t, c.LocalFlagSet().NFlag(), 1)
+	expect(t, c.LocalFlagSet().Arg(0), "arg")
+	expect(t, c.GlobalFlagSet().Lookup("verbose").Value.String(), "true")
+	expect(t, c.GlobalFlagSet().Arg(0), "cmd")
+}
+
 func TestContext_Int(t *testing.T) {
 	set := flag.NewFlagSet("test", 0)
 	set.Int("myflag", 12, "doc")
@@ -26,6 +50,64 @@ func TestContext_Int(t *testing.T) {
 	expect(t, c.Int("myflag"), 12)
 }
 
+func TestContext_Float64(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Float64("myflag", 17.5, "doc")
+	set.Float64("otherflag", 0, "doc")
+	set.String("stringflag", "1.5", "doc")
+	globalSet := flag.NewFlagSet("test", 0)
+	globalSet.Float64("myflag", 42.25, "doc")
+	c := cli.NewContext(nil, set, globalSet)
+	set.Parse([]string{"--myflag", "1.93"})
+	expect(t, c.Float64("myflag"), 1.93)
+	expect(t, c.Float64("otherflag"), float64(0))
+	expect(t, c.Float64("stringflag"), float64(0))
+	expect(t, c.Float64("bogusflag"), float64(0))
+	expect(t, c.GlobalFloat64("myflag"), 42.25)
+}
+
+func TestContext_Int64(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Int64("myflag", 12, "doc")
+	set.Int("intflag", 5, "doc")
+	globalSet := flag.NewFlagSet("test", 0)
+	globalSet.Int64("myflag", 42, "doc")
+	c := cli.NewContext(nil, set, globalSet)
+	set.Parse([]string{"--myflag", "-8589934592"})
+	expect(t, c.Int64("myflag"), int64(-8589934592))
+	expect(t, c.Int64("intflag"), int64(0))
+	expect(t, c.Int64("bogusflag"), int64(0))
+	expect(t, c.GlobalInt64("myflag"), int64(42))
+}
+
+func TestContext_Uint(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Uint("myflag", 12, "doc")
+	set.String("stringflag", "3", "doc")
+	globalSet := flag.NewFlagSet("test", 0)
+	globalSet.Uint("myflag", 42, "doc")
+	c := cli.NewContext(nil, set, globalSet)
+	set.Parse([]string{"--myflag", "7"})
+	expect(t, c.Uint("myflag"), uint(7))
+	expect(t, c.Uint("stringflag"), uint(0))
+	expect(t, c.Uint("bogusflag"), uint(0))
+	expect(t, c.GlobalUint("myflag"), uint(42))
+}
+
+func TestContext_Uint64(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Uint64("myflag", 12, "doc")
+	set.Uint("uintflag", 3, "doc")
+	globalSet := flag.NewFlagSet("test", 0)
+	globalSet.Uint64("myflag", 42, "doc")
+	c := cli.NewContext(nil, set, globalSet)
+	set.Parse([]string{"--myflag", "18446744073709551615"})
+	expect(t, c.Uint64("myflag"), uint64(18446744073709551615))
+	expect(t, c.Uint64("uintflag"), uint64(0))
+	expect(t, c.Uint64("bogusflag"), uint64(0))
+	expect(t, c.GlobalUint64("myflag"), uint64(42))
+}
+
 func TestContext_String(t *testing.T) {
 	set := flag.NewFlagSet("test", 0)
 	set.String("myflag", "hello world", "doc")
@@ -56,6 +138,231 @@ func TestContext_Args(t *testing.T) {
 	expect(t, c.Bool("myflag"), true)
 }
 
+func TestContext_IntArgs(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"1", "-2", "30"})
+	ints, err := c.IntArgs()
+	expect(t, err, nil)
+	if !reflect.DeepEqual(ints, []int{1, -2, 30}) {
+		t.Errorf("unexpected ints %v", ints)
+	}
+
+	set.Parse([]string{"1", "two", "3.5"})
+	ints, err = c.IntArgs()
+	expect(t, len(ints), 0)
+	expect(t, err.Error(), `argument 2 "two" is not an int`)
+}
+
+func TestContext_Float64Args(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"1", "2.5", "-0.25"})
+	floats, err := c.Float64Args()
+	expect(t, err, nil)
+	if !reflect.DeepEqual(floats, []float64{1, 2.5, -0.25}) {
+		t.Errorf("unexpected floats %v", floats)
+	}
+
+	set.Parse([]string{"1.5", "2", "x"})
+	floats, err = c.Float64Args()
+	expect(t, len(floats), 0)
+	expect(t, err.Error(), `argument 3 "x" is not a number`)
+}
+
+func TestContext_ArgsCopy(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.Parse([]string{"a", "b", "--", "c"})
+	c := cli.NewContext(nil, set, set)
+
+	args := c.Args()
+	args[0] = "changed"
+	args = append(args, "added")
+	passthrough := c.PassthroughArgs()
+	passthrough[0] = "changed"
+
+	expect(t, strings.Join(c.Args(), " "), "a b")
+	expect(t, strings.Join(c.PassthroughArgs(), " "), "c")
+	expect(t, strings.Join(set.Args(), " "), "a b -- c")
+}
+
+func TestContext_VisibleFlags(t *testing.T) {
+	names := func(flags []cli.Flag) string {
+		var names []string
+		for _, f := range flags {
+			names = append(names, strings.SplitN(f.String(), "\t", 2)[0])
+		}
+		return strings.Join(names, "; ")
+	}
+
+	var visible, all []cli.Flag
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "region, r", Value: "us", Usage: "the global region"},
+		cli.BoolFlag{Name: "verbose"},
+		cli.AliasFlag{Name: "zone", AliasOf: "region"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "deploy",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "region", Value: "eu", Usage: "the region to deploy to"},
+				cli.IntFlag{Name: "replicas", Value: 1},
+			},
+			Action: func(c *cli.Context) error {
+				visible = c.VisibleFlags(false)
+				all = c.VisibleFlags(true)
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "deploy"})
+	expect(t, err, nil)
+	expect(t, names(visible), "--region 'eu'; --replicas '1'; --help, -h; --verbose; --version, -v")
+	expect(t, names(all), "--region 'eu'; --replicas '1'; --help, -h; --verbose; --zone; --version, -v")
+}
+
+func TestContext_Writers(t *testing.T) {
+	var out, errOut bytes.Buffer
+	app := cli.NewApp()
+	app.Writer = &out
+	app.ErrWriter = &errOut
+	app.Commands = []cli.Command{
+		{
+			Name: "greet",
+			Action: func(c *cli.Context) error {
+				fmt.Fprintln(c.Writer(), "hello", c.Args().First())
+				fmt.Fprintln(c.ErrWriter(), "greeted")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "greet", "bob"})
+	expect(t, err, nil)
+	expect(t, out.String(), "hello bob\n")
+	expect(t, errOut.String(), "greeted\n")
+
+	c := cli.NewContext(nil, flag.NewFlagSet("test", 0), nil)
+	expect(t, c.Writer(), io.Writer(os.Stdout))
+	expect(t, c.ErrWriter(), io.Writer(os.Stderr))
+}
+
+func TestContext_Lookup(t *testing.T) {
+	var port, dir, missing *flag.Flag
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.IntFlag{Name: "port, p", Value: 80, Usage: "the port"},
+		cli.StringFlag{Name: "directory"},
+		cli.AliasFlag{Name: "dir", AliasOf: "directory"},
+	}
+	app.Action = func(c *cli.Context) error {
+		port, dir, missing = c.Lookup("p"), c.Lookup("dir"), c.Lookup("bogus")
+		return nil
+	}
+
+	err := app.Run([]string{"serve", "-p", "8080", "--dir", "/srv"})
+	expect(t, err, nil)
+	expect(t, port.Name, "p")
+	expect(t, port.Value.String(), "8080")
+	expect(t, port.Usage, "the port")
+	expect(t, dir.Name, "directory")
+	expect(t, dir.Value.String(), "/srv")
+	if missing != nil {
+		t.Errorf("expected no flag, got %v", missing)
+	}
+}
+
+var aliasedGetterTests = []struct {
+	flag     cli.Flag
+	args     []string
+	get      func(c *cli.Context) interface{}
+	expected string
+}{
+	{cli.IntFlag{Name: "value"}, []string{"--alias", "-3"}, func(c *cli.Context) interface{} { return c.Int("alias") }, "-3"},
+	{cli.Float64Flag{Name: "value"}, []string{"--alias", "1.5"}, func(c *cli.Context) interface{} { return c.Float64("alias") }, "1.5"},
+	{cli.Int64Flag{Name: "value"}, []string{"--alias", "-9000000000"}, func(c *cli.Context) interface{} { return c.Int64("alias") }, "-9000000000"},
+	{cli.UintFlag{Name: "value"}, []string{"--alias", "7"}, func(c *cli.Context) interface{} { return c.Uint("alias") }, "7"},
+	{cli.Uint64Flag{Name: "value"}, []string{"--alias", "9000000000"}, func(c *cli.Context) interface{} { return c.Uint64("alias") }, "9000000000"},
+	{cli.DurationFlag{Name: "value"}, []string{"--alias", "90s"}, func(c *cli.Context) interface{} { return c.Duration("alias") }, "1m30s"},
+	{cli.TimestampFlag{Name: "value"}, []string{"--alias", "2024-01-02T15:04:05Z"}, func(c *cli.Context) interface{} { return c.Timestamp("alias").Year() }, "2024"},
+	{cli.BoolFlag{Name: "value"}, []string{"--alias"}, func(c *cli.Context) interface{} { return c.Bool("alias") }, "true"},
+	{cli.BoolTFlag{Name: "value"}, []string{"--alias=false"}, func(c *cli.Context) interface{} { return c.BoolT("alias") }, "false"},
+	{cli.CountFlag{Name: "value"}, []string{"--alias", "--alias"}, func(c *cli.Context) interface{} { return c.Count("alias") }, "2"},
+	{cli.StringFlag{Name: "value"}, []string{"--alias", "x"}, func(c *cli.Context) interface{} { return c.String("alias") }, "x"},
+	{cli.StringSliceFlag{Name: "value"}, []string{"--alias", "a", "--alias", "b"}, func(c *cli.Context) interface{} { return c.StringSlice("alias") }, "[a b]"},
+	{cli.IntSliceFlag{Name: "value"}, []string{"--alias", "1", "--alias", "2"}, func(c *cli.Context) interface{} { return c.IntSlice("alias") }, "[1 2]"},
+	{cli.UintSliceFlag{Name: "value"}, []string{"--alias", "1"}, func(c *cli.Context) interface{} { return c.UintSlice("alias") }, "[1]"},
+	{cli.NewIPFlag("value", nil, ""), []string{"--alias", "10.0.0.1"}, func(c *cli.Context) interface{} { return c.IP("alias") }, "10.0.0.1"},
+	{cli.NewIPFlag("value", nil, ""), []string{"--alias", "10.0.0.1"}, func(c *cli.Context) interface{} { return c.Generic("alias") }, "10.0.0.1"},
+	{cli.NewByteSizeFlag("value", 0, ""), []string{"--alias", "2KiB"}, func(c *cli.Context) interface{} { return c.ByteSize("alias") }, "2048"},
+	{cli.NewPercentFlag("value", 0, ""), []string{"--alias", "50%"}, func(c *cli.Context) interface{} { return c.Percent("alias") }, "0.5"},
+	{cli.NewPathFlag("value", "", ""), []string{"--alias", "a/../b"}, func(c *cli.Context) interface{} { return c.Path("alias") }, "b"},
+	{cli.PathSliceFlag{Name: "value"}, []string{"--alias", "a/../b"}, func(c *cli.Context) interface{} { return c.PathSlice("alias") }, "[b]"},
+	{cli.NewIPNetFlag("value", nil, ""), []string{"--alias", "10.0.0.0/8"}, func(c *cli.Context) interface{} { return c.IPNet("alias") }, "10.0.0.0/8"},
+	{cli.NewURLFlag("value", "", ""), []string{"--alias", "https://example.com"}, func(c *cli.Context) interface{} { return c.URL("alias") }, "https://example.com"},
+	{cli.NewEnumSliceFlag("value", []string{"a", "b"}, ""), []string{"--alias", "b,a"}, func(c *cli.Context) interface{} { return c.EnumSlice("alias") }, "[b a]"},
+}
+
+func TestContext_AliasedGetters(t *testing.T) {
+	for _, test := range aliasedGetterTests {
+		var value interface{}
+		app := cli.NewApp()
+		app.Flags = []cli.Flag{test.flag, cli.AliasFlag{Name: "alias", AliasOf: "value"}}
+		app.Action = func(c *cli.Context) error {
+			value = test.get(c)
+			return nil
+		}
+
+		err := app.Run(append([]string{"run"}, test.args...))
+		expect(t, err, nil)
+		if got := fmt.Sprint(value); got != test.expected {
+			t.Errorf("%T read by its alias gave %s, expected %s", test.flag, got, test.expected)
+		}
+	}
+}
+
+func TestContext_StringMapAndKeyValueSlice(t *testing.T) {
+	var labels, globalLabels, missingMap, mismatchedMap map[string]string
+	var headers, missingSlice, mismatchedSlice []cli.KeyValue
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{
+		cli.NewStringMapFlag("label", nil, "labels"),
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "send",
+			Flags: []cli.Flag{
+				cli.NewKeyValueSliceFlag("header", nil, "headers"),
+				cli.AliasFlag{Name: "H", AliasOf: "header"},
+				cli.StringFlag{Name: "body"},
+			},
+			Action: func(c *cli.Context) error {
+				headers, missingSlice, mismatchedSlice = c.KeyValueSlice("H"), c.KeyValueSlice("bogus"), c.KeyValueSlice("body")
+				labels, globalLabels = c.StringMap("label"), c.GlobalStringMap("label")
+				missingMap, mismatchedMap = c.StringMap("bogus"), c.StringMap("body")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"app", "--label", "env=prod", "--label", "tier=web", "send", "-H", "Accept=text/plain", "--header", "X-Id=7"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(headers, []cli.KeyValue{{Key: "Accept", Value: "text/plain"}, {Key: "X-Id", Value: "7"}}) {
+		t.Errorf("unexpected headers %v", headers)
+	}
+	if !reflect.DeepEqual(globalLabels, map[string]string{"env": "prod", "tier": "web"}) {
+		t.Errorf("unexpected labels %v", globalLabels)
+	}
+	expect(t, len(labels), 0)
+	expect(t, len(missingMap), 0)
+	expect(t, len(mismatchedMap), 0)
+	expect(t, len(missingSlice), 0)
+	expect(t, len(mismatchedSlice), 0)
+	expect(t, missingMap != nil && missingSlice != nil, true)
+}
+
 func TestContext_IsSet(t *testing.T) {
 	set := flag.NewFlagSet("test", 0)
 	set.Bool("myflag", false, "doc")
@@ -66,3 +373,162 @@ func TestContext_IsSet(t *testing.T) {
 	expect(t, c.IsSet("otherflag"), false)
 	expect(t, c.IsSet("bogusflag"), false)
 }
+
+func TestContext_IsSetByAnyName(t *testing.T) {
+	for _, arg := range []string{"--verbose", "--loud", "-v"} {
+		var values, set []string
+		app := cli.NewApp()
+		app.Commands = []cli.Command{
+			{
+				Name: "run",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "verbose, loud, v"},
+					cli.StringSliceFlag{Name: "tag, label, t", Value: &cli.StringSlice{}},
+				},
+				Action: func(c *cli.Context) error {
+					for _, name := range []string{"verbose", "loud", "v"} {
+						values = append(values, c.String(name))
+						set = append(set, fmt.Sprint(c.IsSet(name)))
+					}
+					for _, name := range []string{"tag", "label", "t"} {
+						values = append(values, strings.Join(c.StringSlice(name), ","))
+						set = append(set, fmt.Sprint(c.IsSet(name)))
+					}
+					return nil
+				},
+			},
+		}
+
+		err := app.Run([]string{"command", "run", arg, "all", "--label", "a", "-t", "b"})
+		expect(t, err, nil)
+		expect(t, strings.Join(values, " "), "all all all a,b a,b a,b")
+		expect(t, strings.Join(set, " "), "true true true true true true")
+	}
+}
+
+func TestContext_RequireOneOf(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("file", "", "doc")
+	set.String("url", "", "doc")
+	set.Bool("stdin", false, "doc")
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"arg"})
+	expect(t, c.RequireOneOf("file", "url", "stdin").Error(), "One of --file, --url or --stdin is required")
+	expect(t, c.RequireOneOf("file").Error(), "--file is required")
+
+	set = flag.NewFlagSet("test", 0)
+	set.String("file", "", "doc")
+	set.String("url", "", "doc")
+	set.Bool("stdin", false, "doc")
+	c = cli.NewContext(nil, set, set)
+	set.Parse([]string{"--url", ""})
+	expect(t, c.RequireOneOf("file", "url", "stdin"), nil)
+}
+
+var machineOutputTests = []struct {
+	args     []string
+	expected bool
+}{
+	{[]string{"--output", "json"}, true},
+	{[]string{"-o", "yaml"}, true},
+	{[]string{"-o", "text"}, false},
+	{[]string{}, false},
+}
+
+func TestContext_IsMachineOutput(t *testing.T) {
+	flags := []cli.Flag{cli.StringFlag{Name: "output, o", Value: "text"}}
+	for _, test := range machineOutputTests {
+		c, err := cli.ParseFlags("test", flags, test.args)
+		expect(t, err, nil)
+		expect(t, c.IsMachineOutput(), test.expected)
+	}
+
+	c, err := cli.ParseFlags("test", nil, []string{"arg"})
+	expect(t, err, nil)
+	expect(t, c.IsMachineOutput(), false)
+}
+
+func TestContext_IsMachineOutputGlobal(t *testing.T) {
+	machine := false
+	app := cli.NewApp()
+	app.Flags = []cli.Flag{cli.StringFlag{Name: "output, o", Value: "text"}}
+	app.Commands = []cli.Command{
+		{
+			Name: "list",
+			Action: func(c *cli.Context) error {
+				machine = c.IsMachineOutput()
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"run", "-o", "json", "list"})
+	expect(t, err, nil)
+	expect(t, machine, true)
+}
+
+func TestContext_OpenInput(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "input.txt")
+	ioutil.WriteFile(path, []byte("from file"), 0644)
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("input", "", "doc")
+	set.String("missing", "", "doc")
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"--input", path})
+
+	r, err := c.OpenInput("input")
+	expect(t, err, nil)
+	contents, _ := ioutil.ReadAll(r)
+	r.Close()
+	expect(t, string(contents), "from file")
+
+	_, err = c.OpenInput("missing")
+	refute(t, err, nil)
+
+	set.Parse([]string{"--input", filepath.Join(t.TempDir(), "none.txt")})
+	r, err = c.OpenInput("input")
+	refute(t, err, nil)
+	if r != nil {
+		t.Errorf("expected a nil reader, got %#v", r)
+	}
+}
+
+func TestContext_OpenInputStdin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stdin.txt")
+	ioutil.WriteFile(path, []byte("from stdin"), 0644)
+	stdin, _ := os.Open(path)
+	defer stdin.Close()
+
+	oldStdin := os.Stdin
+	defer func() {
+		os.Stdin = oldStdin
+	}()
+	os.Stdin = stdin
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("input", "", "doc")
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"--input", "-"})
+
+	r, err := c.OpenInput("input")
+	expect(t, err, nil)
+	contents, _ := ioutil.ReadAll(r)
+	expect(t, string(contents), "from stdin")
+
+	// closing the reader must leave stdin open
+	r.Close()
+	_, err = stdin.Seek(0, 0)
+	expect(t, err, nil)
+}
+
+func TestContext_FlagSource(t *testing.T) {
+	set := flag.NewFlagSet("test", 0)
+	set.String("myflag", "hello world", "doc")
+	set.String("otherflag", "hello world", "doc")
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{"--myflag", "bat"})
+	expect(t, c.FlagSource("myflag"), "cmdline")
+	expect(t, c.FlagSource("otherflag"), "default")
+	expect(t, c.FlagSource("bogusflag"), "")
+}
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"text/tabwriter"
+)
+
+// DebugCommand helps debug the configuration of the App. It is hidden from
+// help, add it to App.Commands to use it:
+//
+//	app.Commands = append(app.Commands, cli.DebugCommand)
+//
+// Its flags subcommand prints every global flag with its effective value and
+// where that value comes from, see Context.FlagSource. The values of secret
+// flags are redacted.
+var DebugCommand = Command{
+	Name:   "debug",
+	Usage:  "Helps debug the configuration of the application",
+	Hidden: true,
+	Subcommands: []Command{
+		{
+			Name:  "flags",
+			Usage: "Prints the value of every global flag and where it comes from",
+			Action: func(c *Context) error {
+				printFlagSources(c)
+				return nil
+			},
+		},
+	},
+}
+
+// Prints the flags of the root App with their values and sources
+func printFlagSources(c *Context) {
+	lineage := c.lineage()
+	root := lineage[len(lineage)-1]
+
+	w := tabwriter.NewWriter(c.Writer(), 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "FLAG\tVALUE\tSOURCE")
+	for _, f := range root.App.Flags {
+		switch f.getName() {
+		case HelpFlag.Name, VersionFlag.Name, BashCompletionFlag.Name:
+			continue
+		}
+		if hiddenFlag(f) {
+			continue
+		}
+
+		name := firstName(f)
+		ff := root.flagSet.Lookup(name)
+		if ff == nil {
+			continue
+		}
+		value := ff.Value.String()
+		if isSecret(f) {
+			value = redact(value)
+		}
+		fmt.Fprintf(w, "%s%s\t%s\t%s\n", prefixFor(name), name, value, root.FlagSource(name))
+	}
+	w.Flush()
+}
+
+// Returns the first of the names of a flag
+func firstName(f Flag) string {
+	var first string
+	eachName(f.getName(), func(name string) {
+		if first == "" {
+			first = name
+		}
+	})
+	return first
+}
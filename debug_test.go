@@ -0,0 +1,83 @@
+package cli_test
+
+import (
+	"bytes"
+	"github.com/zenoss/cli"
+	"strings"
+	"testing"
+)
+
+func TestDebugCommand_Flags(t *testing.T) {
+	t.Setenv("GREET_LANG", "spanish")
+	t.Setenv("GREET_TOKEN", "hunter2")
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	app.Flags = []cli.Flag{
+		cli.EnvStringFlag{Name: "lang, l", Value: "english", EnvVar: "GREET_LANG"},
+		cli.EnvStringFlag{Name: "token", EnvVar: "GREET_TOKEN", Secret: true},
+		cli.StringFlag{Name: "name", Value: "world"},
+		cli.IntFlag{Name: "count", Value: 1},
+	}
+	app.Commands = []cli.Command{cli.DebugCommand}
+
+	err := app.Run([]string{"greet", "--count", "3", "debug", "flags"})
+	expect(t, err, nil)
+
+	lines := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		fields := strings.Fields(line)
+		lines[fields[0]] = fields[1:]
+	}
+	expect(t, strings.Join(lines["--lang"], " "), "spanish env")
+	expect(t, strings.Join(lines["--token"], " "), "*** env")
+	expect(t, strings.Join(lines["--name"], " "), "world default")
+	expect(t, strings.Join(lines["--count"], " "), "3 cmdline")
+	_, ok := lines["--help"]
+	expect(t, ok, false)
+}
+
+func TestDebugCommand_WrappedFlags(t *testing.T) {
+	t.Setenv("GREET_TOKEN", "hunter2")
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	app.Flags = []cli.Flag{
+		cli.NormalizedFlag{Flag: cli.EnvStringFlag{Name: "token", EnvVar: "GREET_TOKEN", Secret: true}, Normalize: strings.TrimSpace},
+		cli.StringFlag{Name: "directory", Value: "."},
+		cli.NormalizedFlag{Flag: cli.AliasFlag{Name: "dir", AliasOf: "directory"}, Normalize: strings.TrimSpace},
+	}
+	app.Commands = []cli.Command{cli.DebugCommand}
+
+	err := app.Run([]string{"greet", "debug", "flags"})
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "hunter2"), false)
+	expect(t, strings.Contains(out.String(), "--token"), true)
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "--token") {
+			expect(t, strings.Join(strings.Fields(line), " "), "--token *** env")
+		}
+	}
+
+	out.Reset()
+	err = app.Run([]string{"greet", "--help"})
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "--directory"), true)
+	expect(t, strings.Contains(out.String(), "--dir "), false)
+}
+
+func TestDebugCommand_Hidden(t *testing.T) {
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	app.Commands = []cli.Command{cli.DebugCommand}
+
+	err := app.Run([]string{"greet", "--help"})
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "debug"), false)
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+// The function used to end the program by DefaultExitErrHandler.
+// Override it to keep the process alive, e.g. in tests.
+var OsExiter = os.Exit
+
+// Logger receives the diagnostic messages of the cli package. *log.Logger
+// satisfies it.
+type Logger interface {
+	Printf(format string, v ...interface{})
+}
+
+// ExitCoder is an error that carries the code the program should exit with
+type ExitCoder interface {
+	error
+	ExitCode() int
+}
+
+// Retryable is an error that tells whether the operation that failed may be
+// tried again, see Command.Retries
+type Retryable interface {
+	error
+	Retryable() bool
+}
+
+func isRetryable(err error) bool {
+	r, ok := err.(Retryable)
+	return ok && r.Retryable()
+}
+
+// ExitError is an error with an exit code
+type ExitError struct {
+	message  string
+	exitCode int
+}
+
+// Creates a new ExitError with the given message and exit code
+func NewExitError(message string, exitCode int) *ExitError {
+	return &ExitError{message: message, exitCode: exitCode}
+}
+
+func (e *ExitError) Error() string {
+	return e.message
+}
+
+func (e *ExitError) ExitCode() int {
+	return e.exitCode
+}
+
+// ParseError is returned by Run when the command line could not be parsed
+type ParseError struct {
+	// The full name of the App or Command whose arguments were being parsed,
+	// such as "git remote add"
+	Command string
+	// The error reported by the flag package
+	Err error
+}
+
+func (e *ParseError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// Prints err to the App's ErrWriter and exits with the code of err if it is
+// an ExitCoder, or 1 otherwise. Set it as the App.ExitErrHandler for the
+// errors of actions and hooks to end the program from Run, before App.After.
+func DefaultExitErrHandler(c *Context, err error) {
+	if err == nil {
+		return
+	}
+
+	fmt.Fprintln(c.App.errWriter(), err)
+	OsExiter(c.App.exitCode(err))
+}
+
+func (a *App) errWriter() io.Writer {
+	if a.ErrWriter != nil {
+		return a.ErrWriter
+	}
+	return os.Stderr
+}
+
+func (a *App) writer() io.Writer {
+	if a.Writer != nil {
+		return a.Writer
+	}
+	return os.Stdout
+}
+
+func (a *App) reader() io.Reader {
+	if a.Reader != nil {
+		return a.Reader
+	}
+	return os.Stdin
+}
+
+func (a *App) logger() Logger {
+	if a.Logger != nil {
+		return a.Logger
+	}
+	return log.New(a.errWriter(), "", 0)
+}
+
+// Passes err to the ExitErrHandler, unless it is a usage error, which has
+// already been reported along with the help
+func (a *App) handleExitErr(c *Context, err error) {
+	if _, ok := err.(*ParseError); ok {
+		return
+	}
+	if err != nil && a.ExitErrHandler != nil {
+		a.ExitErrHandler(c, err)
+	}
+}
@@ -0,0 +1,453 @@
+package cli_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/zenoss/cli"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestApp_ExitErrHandler(t *testing.T) {
+	beforeError := fmt.Errorf("fail")
+	var handled []error
+
+	app := cli.NewApp()
+	app.ExitErrHandler = func(c *cli.Context, err error) {
+		handled = append(handled, err)
+	}
+	app.Before = func(c *cli.Context) error {
+		return beforeError
+	}
+
+	err := app.Run([]string{"command"})
+	expect(t, err, beforeError)
+	expect(t, len(handled), 1)
+	expect(t, handled[0], beforeError)
+}
+
+func TestApp_ExitErrHandlerCommandBefore(t *testing.T) {
+	beforeError := fmt.Errorf("fail")
+	var handled []error
+
+	app := cli.NewApp()
+	app.ExitErrHandler = func(c *cli.Context, err error) {
+		handled = append(handled, err)
+	}
+	app.Commands = []cli.Command{
+		{
+			Name: "sub",
+			Before: func(c *cli.Context) error {
+				return beforeError
+			},
+			Action: func(c *cli.Context) error {
+				t.Errorf("action run after failed Before")
+				return nil
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "sub"})
+	expect(t, err, beforeError)
+	expect(t, len(handled), 1)
+	expect(t, handled[0], beforeError)
+}
+
+func TestApp_ExitErrHandlerAction(t *testing.T) {
+	actionError := fmt.Errorf("fail")
+	var handled []error
+
+	app := cli.NewApp()
+	app.ExitErrHandler = func(c *cli.Context, err error) {
+		handled = append(handled, err)
+	}
+	action := func(c *cli.Context) error {
+		return actionError
+	}
+	app.Action = action
+	app.Commands = []cli.Command{
+		{Name: "sub", Action: action},
+		{Name: "hooked", Before: func(c *cli.Context) error { return nil }, Action: action},
+	}
+
+	for _, args := range [][]string{{"command"}, {"command", "sub"}, {"command", "hooked"}} {
+		handled = nil
+		err := app.Run(args)
+		expect(t, err, actionError)
+		expect(t, len(handled), 1)
+		expect(t, handled[0], actionError)
+	}
+}
+
+func TestDefaultExitErrHandler(t *testing.T) {
+	oldExiter := cli.OsExiter
+	defer func() {
+		cli.OsExiter = oldExiter
+	}()
+
+	code := 0
+	cli.OsExiter = func(c int) {
+		code = c
+	}
+
+	var errOut bytes.Buffer
+	app := cli.NewApp()
+	app.ErrWriter = &errOut
+	app.ExitErrHandler = cli.DefaultExitErrHandler
+	app.Before = func(c *cli.Context) error {
+		return cli.NewExitError("not allowed", 3)
+	}
+
+	app.Run([]string{"command"})
+	expect(t, code, 3)
+	expect(t, errOut.String(), "not allowed\n")
+
+	app.Before = func(c *cli.Context) error {
+		return fmt.Errorf("failed")
+	}
+	app.Run([]string{"command"})
+	expect(t, code, 1)
+
+	errOut.Reset()
+	code = 0
+	app.Before = nil
+	app.Commands = []cli.Command{
+		{Name: "fail", Action: func(c *cli.Context) error { return cli.NewExitError("action failed", 4) }},
+		{Name: "typo", NoArgs: true, Action: func(c *cli.Context) error { return nil }},
+	}
+	app.Run([]string{"command", "fail"})
+	expect(t, code, 4)
+	expect(t, errOut.String(), "action failed\n")
+
+	errOut.Reset()
+	code = 0
+	app.Writer = ioutil.Discard
+	app.Run([]string{"command", "typo", "extra"})
+	expect(t, code, 0)
+	expect(t, errOut.String(), "")
+}
+
+func TestApp_ParseError(t *testing.T) {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Commands = []cli.Command{
+		{
+			Name:   "hello",
+			Flags:  []cli.Flag{cli.IntFlag{Name: "count"}},
+			Action: func(c *cli.Context) error { return nil },
+		},
+	}
+
+	err := app.Run([]string{"greet", "--bogus"})
+	var parseErr *cli.ParseError
+	expect(t, errors.As(err, &parseErr), true)
+	expect(t, parseErr.Command, "greet")
+	expect(t, err.Error(), "unknown flag: --bogus")
+
+	err = app.Run([]string{"greet", "hello", "--count", "many"})
+	expect(t, errors.As(err, &parseErr), true)
+	expect(t, parseErr.Command, "greet hello")
+	expect(t, errors.Unwrap(err), parseErr.Err)
+	expect(t, strings.HasPrefix(parseErr.Err.Error(), "invalid value \"many\" for flag -count"), true)
+}
+
+func TestApp_UnknownFlagSuggestion(t *testing.T) {
+	app := cli.NewApp()
+	app.Writer = ioutil.Discard
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "verbose"},
+		cli.StringFlag{Name: "output, o"},
+	}
+	app.Action = func(c *cli.Context) error { return nil }
+
+	err := app.Run([]string{"greet", "--verbsoe"})
+	var parseErr *cli.ParseError
+	expect(t, errors.As(err, &parseErr), true)
+	expect(t, err.Error(), "unknown flag: --verbsoe (did you mean --verbose?)")
+
+	err = app.Run([]string{"greet", "--ouput", "x"})
+	expect(t, err.Error(), "unknown flag: --ouput (did you mean --output?)")
+
+	err = app.Run([]string{"greet", "-x"})
+	expect(t, err.Error(), "unknown flag: -x")
+}
+
+func TestApp_UnknownFlagSuggestionHidden(t *testing.T) {
+	app := cli.NewApp()
+	app.Writer = ioutil.Discard
+	app.Flags = []cli.Flag{
+		cli.BoolFlag{Name: "cache"},
+		cli.StringFlag{Name: "colour"},
+		cli.AliasFlag{Name: "colr", AliasOf: "colour"},
+	}
+	app.Action = func(c *cli.Context) error { return nil }
+
+	err := app.Run([]string{"greet", "--colo"})
+	expect(t, err.Error(), "unknown flag: --colo (did you mean --colour?)")
+
+	err = app.Run([]string{"greet", "--no-cach"})
+	expect(t, err.Error(), "unknown flag: --no-cach")
+}
+
+func TestApp_ParseErrorCommandPath(t *testing.T) {
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "git"
+	app.Writer = &out
+	app.Commands = []cli.Command{
+		{
+			Name: "remote",
+			Subcommands: []cli.Command{
+				{
+					Name: "branch",
+					Subcommands: []cli.Command{
+						{
+							Name:   "add",
+							Flags:  []cli.Flag{cli.IntFlag{Name: "depth"}},
+							Action: func(c *cli.Context) error { return nil },
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"git", "remote", "branch", "add", "--depth", "deep"})
+	var parseErr *cli.ParseError
+	expect(t, errors.As(err, &parseErr), true)
+	expect(t, parseErr.Command, "git remote branch add")
+	if !strings.Contains(out.String(), "git remote branch add [command options]") {
+		t.Errorf("expected the command path in the usage, got %q", out.String())
+	}
+}
+
+func TestApp_RunAndExitOnError(t *testing.T) {
+	oldExiter := cli.OsExiter
+	oldArgs := os.Args
+	defer func() {
+		cli.OsExiter = oldExiter
+		os.Args = oldArgs
+	}()
+
+	code := -1
+	cli.OsExiter = func(c int) {
+		code = c
+	}
+
+	app := cli.NewApp()
+	app.Action = func(c *cli.Context) error { return nil }
+
+	os.Args = []string{"greet", "--bogus"}
+	app.RunAndExitOnError()
+	expect(t, code, 2)
+
+	code = -1
+	os.Args = []string{"greet"}
+	app.RunAndExitOnError()
+	expect(t, code, -1)
+
+	var errOut bytes.Buffer
+	app.ErrWriter = &errOut
+	app.Action = func(c *cli.Context) error { return cli.NewExitError("not allowed", 3) }
+	app.RunAndExitOnError()
+	expect(t, code, 3)
+	expect(t, errOut.String(), "not allowed\n")
+}
+
+var exitCodeTests = []struct {
+	args     []string
+	custom   int
+	expected int
+}{
+	{[]string{"greet", "--bogus"}, 0, 2},
+	{[]string{"greet", "--bogus"}, 64, 64},
+	{[]string{"greet", "hello", "--count", "many"}, 0, 2},
+	{[]string{"greet", "hello", "--count", "3", "fail"}, 64, 1},
+	{[]string{"greet", "hello", "--count", "3", "deny"}, 64, 3},
+}
+
+func TestApp_ExitCodes(t *testing.T) {
+	oldExiter := cli.OsExiter
+	oldArgs := os.Args
+	defer func() {
+		cli.OsExiter = oldExiter
+		os.Args = oldArgs
+	}()
+
+	for _, test := range exitCodeTests {
+		code := -1
+		cli.OsExiter = func(c int) {
+			code = c
+		}
+
+		app := cli.NewApp()
+		app.Writer = ioutil.Discard
+		app.UsageErrorExitCode = test.custom
+		app.Commands = []cli.Command{
+			{
+				Name:  "hello",
+				Flags: []cli.Flag{cli.IntFlag{Name: "count"}},
+				Before: func(c *cli.Context) error {
+					switch c.Args().First() {
+					case "fail":
+						return fmt.Errorf("failed")
+					case "deny":
+						return cli.NewExitError("denied", 3)
+					}
+					return nil
+				},
+				Action: func(c *cli.Context) error { return nil },
+			},
+		}
+
+		os.Args = test.args
+		app.RunAndExitOnError()
+		if code != test.expected {
+			t.Errorf("%v exited with %d, expected %d", test.args, code, test.expected)
+		}
+	}
+}
+
+type capturingLogger struct {
+	messages []string
+}
+
+func (l *capturingLogger) Printf(format string, v ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf(format, v...))
+}
+
+func TestApp_Logger(t *testing.T) {
+	logger := &capturingLogger{}
+	var errOut bytes.Buffer
+
+	app := cli.NewApp()
+	app.Debug = true
+	app.Logger = logger
+	app.ErrWriter = &errOut
+	app.Commands = []cli.Command{
+		{
+			Name:      "remote",
+			ShortName: "r",
+			Subcommands: []cli.Command{
+				{
+					Name:      "add",
+					ShortName: "a",
+					Action:    func(c *cli.Context) error { return nil },
+				},
+			},
+		},
+	}
+
+	err := app.Run([]string{"command", "r", "a"})
+	expect(t, err, nil)
+	expect(t, len(logger.messages), 2)
+	expect(t, logger.messages[0], "Warning: command \"remote\" uses the deprecated ShortName, use Aliases instead\n")
+	expect(t, logger.messages[1], "Warning: command \"add\" uses the deprecated ShortName, use Aliases instead\n")
+	expect(t, errOut.String(), "")
+}
+
+func TestApp_DefaultLogger(t *testing.T) {
+	var errOut bytes.Buffer
+
+	app := cli.NewApp()
+	app.ErrWriter = &errOut
+	app.Commands = []cli.Command{
+		{
+			Name:      "remote",
+			ShortName: "r",
+			Action:    func(c *cli.Context) error { return nil },
+		},
+	}
+
+	err := app.Run([]string{"command", "remote"})
+	expect(t, err, nil)
+	expect(t, errOut.String(), "")
+
+	app.Debug = true
+	err = app.Run([]string{"command", "remote"})
+	expect(t, err, nil)
+	expect(t, errOut.String(), "Warning: command \"remote\" uses the deprecated ShortName, use Aliases instead\n")
+}
+
+func TestApp_Quiet(t *testing.T) {
+	for _, flag := range []string{"--quiet", "-q"} {
+		logger := &capturingLogger{}
+		quiet := false
+
+		app := cli.NewApp()
+		app.Debug = true
+		app.EnableQuiet = true
+		app.Logger = logger
+		app.Commands = []cli.Command{
+			{
+				Name:      "remote",
+				ShortName: "r",
+				Subcommands: []cli.Command{
+					{
+						Name: "add",
+						Action: func(c *cli.Context) error {
+							quiet = c.Quiet()
+							return nil
+						},
+					},
+				},
+			},
+		}
+
+		err := app.Run([]string{"command", flag, "remote", "add"})
+		expect(t, err, nil)
+		expect(t, len(logger.messages), 0)
+		expect(t, quiet, true)
+	}
+}
+
+func TestApp_QuietRenamed(t *testing.T) {
+	defer func(flag cli.BoolFlag) { cli.QuietFlag = flag }(cli.QuietFlag)
+	cli.QuietFlag = cli.BoolFlag{Name: "silent, s", Usage: "suppress informational output"}
+
+	quiet := false
+	app := cli.NewApp()
+	app.EnableQuiet = true
+	app.Action = func(c *cli.Context) error {
+		quiet = c.Quiet()
+		return nil
+	}
+
+	err := app.Run([]string{"command", "--silent"})
+	expect(t, err, nil)
+	expect(t, quiet, true)
+}
+
+func TestApp_DebugShadowedCommand(t *testing.T) {
+	for _, debug := range []bool{false, true} {
+		logger := &capturingLogger{}
+		app := cli.NewApp()
+		app.Name = "myapp"
+		app.Debug = debug
+		app.Logger = logger
+		app.Commands = []cli.Command{
+			{Name: "deploy", Action: func(c *cli.Context) error { return nil }},
+			{Name: "add", Action: func(c *cli.Context) error { return nil }},
+			{
+				Name:   "release",
+				Before: func(c *cli.Context) error { return nil },
+				Action: func(c *cli.Context) error { return nil },
+			},
+		}
+
+		err := app.Run([]string{"myapp", "deploy", "add", "web"})
+		expect(t, err, nil)
+		err = app.Run([]string{"myapp", "release", "add"})
+		expect(t, err, nil)
+		if debug {
+			expect(t, len(logger.messages), 2)
+			expect(t, logger.messages[0], "Warning: argument \"add\" of myapp deploy is also the name of the command \"add\"\n")
+			expect(t, logger.messages[1], "Warning: argument \"add\" of myapp release is also the name of the command \"add\"\n")
+		} else {
+			expect(t, len(logger.messages), 0)
+		}
+	}
+}
@@ -1,21 +1,43 @@
 package cli
 
 import (
+	"errors"
 	"flag"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
+	"unicode"
 )
 
 // This flag enables bash-completion for all commands and subcommands
 var BashCompletionFlag = BoolFlag{"generate-bash-completion", ""}
 
+// This flag prints the completion script for the shell in $SHELL, see
+// App.EnableCompletionFlag
+var CompletionFlag = BoolFlag{"completion", "print the completion script for your shell"}
+
 // This flag prints the version for the application
 var VersionFlag = BoolFlag{"version, v", "print the version"}
 
 // This flag prints the help for all commands and subcommands
 var HelpFlag = BoolFlag{"help, h", "show help"}
 
+// This flag asks commands to report what they would do without doing it
+var DryRunFlag = BoolFlag{"dry-run", "show what would be done without making any changes"}
+
+// This flag silences the informational output of the cli package and the
+// actions that consult Context.Quiet
+var QuietFlag = BoolFlag{"quiet, q", "suppress informational output"}
+
+// This flag answers yes to the prompts of the cli package, such as
+// Context.Confirm, so that commands can run without a terminal
+var AssumeYesFlag = BoolFlag{"yes, assume-yes", "answer yes to all prompts"}
+
 // Flag is a common interface related to parsing flags in cli.
 // For more advanced flag parsing techniques, it is recomended that
 // this interface be implemented.
@@ -26,13 +48,317 @@ type Flag interface {
 	getName() string
 }
 
-func flagSet(name string, flags []Flag) *flag.FlagSet {
+func flagSet(name string, flags []Flag, negationPrefix string) (*flag.FlagSet, error) {
 	set := flag.NewFlagSet(name, flag.ContinueOnError)
 
 	for _, f := range flags {
-		f.Apply(set)
+		if err := checkFlagName(f.getName()); err != nil {
+			return nil, err
+		}
+		if onCommandLine(f) {
+			f.Apply(set)
+		}
+	}
+	if negationPrefix != "" {
+		addNegatedFlags(set, flags, negationPrefix)
+	}
+	return set, nil
+}
+
+// Parses args with the given flags the way an App would, without running
+// anything, and returns a context to read the flags and arguments from. Bool
+// flags get negated counterparts with the prefix of NewApp, "no-". The error
+// of args that cannot be parsed is a ParseError.
+func ParseFlags(name string, flags []Flag, args []string) (*Context, error) {
+	return parseFlags(nil, name, flags, args, NewApp().BoolNegationPrefix)
+}
+
+// Parses args with the Flags of the App like ParseFlags, with the
+// BoolNegationPrefix of the App, and returns a context of the App
+func (a *App) ParseFlags(args []string) (*Context, error) {
+	return parseFlags(a, a.Name, a.Flags, args, a.BoolNegationPrefix)
+}
+
+func parseFlags(app *App, name string, flags []Flag, args []string, negationPrefix string) (*Context, error) {
+	set, err := flagSet(name, flags, negationPrefix)
+	if err != nil {
+		return nil, err
+	}
+	set.SetOutput(ioutil.Discard)
+	input := expandShortFlags(args, set)
+	err = unknownFlagError(redactParseError(set.Parse(input), flags), set, flags)
+	if err == nil {
+		err = normalizeFlags(flags, set)
+	}
+	if err != nil {
+		return nil, &ParseError{Command: name, Err: err}
+	}
+
+	ctx := NewContext(app, set, set)
+	ctx.terminated = flagsTerminated(input, set)
+	if err := resolveFlags(flags, ctx); err != nil {
+		return nil, err
+	}
+	return ctx, nil
+}
+
+// Defines a negated counterpart, such as --no-cache for --cache, for every
+// long name of the bool flags. The built in flags, and names that are
+// already defined, are left alone.
+func addNegatedFlags(set *flag.FlagSet, flags []Flag, prefix string) {
+	for _, f := range flags {
+		switch f {
+		case HelpFlag, VersionFlag, BashCompletionFlag:
+			continue
+		}
+		switch unwrapFlag(f).(type) {
+		case BoolFlag, BoolTFlag:
+		default:
+			continue
+		}
+		eachName(f.getName(), func(name string) {
+			if len(name) < 2 || set.Lookup(prefix+name) != nil {
+				return
+			}
+			set.Var(&negatedBool{set, name}, prefix+name, "")
+		})
+	}
+}
+
+// negatedBool sets the bool flag it negates to the opposite of its own value
+type negatedBool struct {
+	set  *flag.FlagSet
+	name string
+}
+
+func (b *negatedBool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	return b.set.Set(b.name, strconv.FormatBool(!v))
+}
+
+func (b *negatedBool) String() string {
+	return "false"
+}
+
+func (b *negatedBool) IsBoolFlag() bool {
+	return true
+}
+
+// The text shown in place of the value of a secret flag
+const redacted = "***"
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redacted
+}
+
+// Reports whether the value of f must not be shown, because f or a flag it
+// wraps is secret
+func isSecret(f Flag) bool {
+	return findFlag(f, func(f Flag) bool {
+		s, ok := f.(interface {
+			isSecret() bool
+		})
+		return ok && s.isSecret()
+	}) != nil
+}
+
+var undefinedFlagError = regexp.MustCompile(`^flag provided but not defined: -(.+)$`)
+
+// Rewrites the parse error of an undefined flag as "unknown flag: --name",
+// suggesting the name of flags closest to it when there is one. Hidden flags
+// and the negated names of bool flags are not suggested.
+func unknownFlagError(err error, set *flag.FlagSet, flags []Flag) error {
+	if err == nil {
+		return nil
+	}
+	match := undefinedFlagError.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	name := match[1]
+	msg := fmt.Sprintf(UnknownFlagText, prefixFor(name)+name)
+
+	suggestion, best := "", 0
+	for _, f := range flags {
+		if hiddenFlag(f) {
+			continue
+		}
+		eachName(f.getName(), func(defined string) {
+			if set.Lookup(defined) == nil {
+				return
+			}
+			d := editDistance(name, defined)
+			if suggestion == "" || d < best {
+				suggestion, best = defined, d
+			}
+		})
+	}
+	if suggestion != "" && (best <= 2 || best <= len(name)/3) && best < len(name) {
+		msg += " (" + fmt.Sprintf(DidYouMeanText, prefixFor(suggestion)+suggestion) + ")"
+	}
+	return errors.New(msg)
+}
+
+// Returns the number of single character insertions, deletions and
+// substitutions that turn a into b
+func editDistance(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			current[j] = previous[j-1]
+			if a[i-1] != b[j-1] {
+				current[j]++
+			}
+			if previous[j]+1 < current[j] {
+				current[j] = previous[j] + 1
+			}
+			if current[j-1]+1 < current[j] {
+				current[j] = current[j-1] + 1
+			}
+		}
+		previous, current = current, previous
+	}
+	return previous[len(b)]
+}
+
+var invalidValueError = regexp.MustCompile(`^invalid value ("(?:[^"\\]|\\.)*") for flag -(\S+): `)
+
+// Removes the value from a parse error of a secret flag. The flag package
+// quotes the rejected value in its message, and the error of the value's Set
+// method may repeat it.
+func redactParseError(err error, flags []Flag) error {
+	if err == nil {
+		return nil
+	}
+	match := invalidValueError.FindStringSubmatch(err.Error())
+	if match == nil {
+		return err
+	}
+	value, uerr := strconv.Unquote(match[1])
+	if uerr != nil || value == "" {
+		return err
+	}
+
+	for _, f := range flags {
+		secret := false
+		eachName(f.getName(), func(name string) {
+			secret = secret || name == match[2]
+		})
+		if secret && isSecret(f) {
+			msg := strings.Replace(err.Error(), match[1], strconv.Quote(redacted), -1)
+			return errors.New(strings.Replace(msg, value, redacted, -1))
+		}
+	}
+	return err
+}
+
+// Reports whether f can be given on the command line. Flags that cannot are
+// left out of help and only added to the flag set after parsing.
+func onCommandLine(f Flag) bool {
+	if cl, ok := unwrapFlag(f).(interface {
+		onCommandLine() bool
+	}); ok {
+		return cl.onCommandLine()
+	}
+	return true
+}
+
+// A flag that adds to the flag it wraps, such as OrderedFlag. The optional
+// methods of flags, such as hidden and envVars, are looked up on the
+// innermost flag, so wrappers need not forward them. Only isSecret is asked
+// of every flag in the chain, so SecretFlag can wrap any flag.
+type flagWrapper interface {
+	wrapped() Flag
+}
+
+// Returns the first of f and the flags it wraps, outermost first, that match
+// is true for, or nil when there is none
+func findFlag(f Flag, match func(f Flag) bool) Flag {
+	for !match(f) {
+		w, ok := f.(flagWrapper)
+		if !ok {
+			return nil
+		}
+		f = w.wrapped()
+	}
+	return f
+}
+
+// Returns the flag wrapped by OrderedFlag, NormalizedFlag, CompletedFlag and
+// SecretFlag, or f itself when it wraps none
+func unwrapFlag(f Flag) Flag {
+	return findFlag(f, func(f Flag) bool {
+		_, ok := f.(flagWrapper)
+		return !ok
+	})
+}
+
+// Reports whether a flag is left out of help and completions
+func hiddenFlag(f Flag) bool {
+	h, ok := unwrapFlag(f).(interface {
+		hidden() bool
+	})
+	return ok && h.hidden()
+}
+
+// Returns the comma separated environment variables f takes its value from,
+// if any
+func flagEnvVars(f Flag) string {
+	if e, ok := unwrapFlag(f).(interface {
+		envVars() string
+	}); ok {
+		return e.envVars()
+	}
+	return ""
+}
+
+// Checks that each of the comma separated names of a flag is a bare name,
+// which is given without dashes and has no spaces
+func checkFlagName(fullName string) error {
+	for _, name := range strings.Split(fullName, ",") {
+		name = strings.Trim(name, " ")
+		switch {
+		case name == "":
+			return fmt.Errorf("Invalid flag name %q: names must not be empty", fullName)
+		case strings.HasPrefix(name, "-"):
+			return fmt.Errorf("Invalid flag name %q: %q must not start with a dash", fullName, name)
+		case strings.IndexFunc(name, unicode.IsSpace) >= 0:
+			return fmt.Errorf("Invalid flag name %q: %q must not contain spaces", fullName, name)
+		}
+	}
+	return nil
+}
+
+// Reports whether one of the names of f is given as a flag in args. Names
+// defined by the skip flag set, and anything after a "--" terminator, are
+// ignored.
+func argsHaveFlag(args []string, f BoolFlag, skip *flag.FlagSet) bool {
+	found := false
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+		eachName(f.Name, func(name string) {
+			if skip != nil && skip.Lookup(name) != nil {
+				return
+			}
+			if arg == "-"+name || arg == "--"+name {
+				found = true
+			}
+		})
 	}
-	return set
+	return found
 }
 
 func eachName(longName string, fn func(string)) {
@@ -54,10 +380,16 @@ type GenericFlag struct {
 	Name  string
 	Value Generic
 	Usage string
+	// Show *** instead of the value in help and parse errors
+	Secret bool
 }
 
 func (f GenericFlag) String() string {
-	return fmt.Sprintf("%s%s %v\t`%v` %s", prefixFor(f.Name), f.Name, f.Value, "-"+f.Name+" option -"+f.Name+" option", f.Usage)
+	value := f.Value.String()
+	if f.Secret {
+		value = redact(value)
+	}
+	return fmt.Sprintf("%s%s %v\t`%v` %s", prefixFor(f.Name), f.Name, value, "-"+f.Name+" option -"+f.Name+" option", f.Usage)
 }
 
 func (f GenericFlag) Apply(set *flag.FlagSet) {
@@ -70,6 +402,36 @@ func (f GenericFlag) getName() string {
 	return f.Name
 }
 
+func (f GenericFlag) isSecret() bool {
+	return f.Secret
+}
+
+// Bool is a Generic boolean value. Like BoolFlag it needs no argument, so
+// --name alone sets it to true while --name=false still parses.
+type Bool bool
+
+func (b *Bool) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	*b = Bool(v)
+	return nil
+}
+
+func (b *Bool) String() string {
+	return strconv.FormatBool(bool(*b))
+}
+
+func (b *Bool) Value() bool {
+	return bool(*b)
+}
+
+// Tells the flag package that this value takes no argument
+func (b *Bool) IsBoolFlag() bool {
+	return true
+}
+
 type StringSlice []string
 
 func (f *StringSlice) Set(value string) error {
@@ -89,6 +451,13 @@ type StringSliceFlag struct {
 	Name  string
 	Value *StringSlice
 	Usage string
+	// The most times the flag can be given, 0 for no limit
+	MaxItems int
+	// Whether the values given replace those of Value rather than add to them
+	ReplaceDefaults bool
+	// Whether the flag is given files to read the values from, one per line.
+	// Blank lines and lines starting with # are skipped.
+	FromLines bool
 }
 
 func (f StringSliceFlag) String() string {
@@ -98,8 +467,23 @@ func (f StringSliceFlag) String() string {
 }
 
 func (f StringSliceFlag) Apply(set *flag.FlagSet) {
+	values := f.Value
+	if values == nil {
+		values = &StringSlice{}
+	}
+	var reset func()
+	if f.ReplaceDefaults {
+		defaults := append(StringSlice{}, *values...)
+		values = &defaults
+		reset = func() { *values = nil }
+	}
+	var value flag.Value = values
+	if f.FromLines {
+		value = &fileLines{value}
+	}
+	value = wrapSlice(value, f.Name, f.MaxItems, reset)
 	eachName(f.Name, func(name string) {
-		set.Var(f.Value, name, f.Usage)
+		set.Var(value, name, f.Usage)
 	})
 }
 
@@ -107,6 +491,85 @@ func (f StringSliceFlag) getName() string {
 	return f.Name
 }
 
+// sliceOptions wraps the value of a slice flag to limit how many times it can
+// be given and to clear its defaults when it is first given. All the names of
+// the flag share one sliceOptions.
+type sliceOptions struct {
+	flag.Value
+	name  string
+	max   int
+	count int
+	// clears the defaults, nil to add to them
+	reset func()
+}
+
+func (o *sliceOptions) Set(value string) error {
+	if o.max > 0 && o.count >= o.max {
+		return fmt.Errorf(TooManyValuesText, o.name, o.max)
+	}
+	if o.count == 0 && o.reset != nil {
+		o.reset()
+	}
+	o.count++
+	return o.Value.Set(value)
+}
+
+// Wraps the value of the slice flag with the given names so it can be given
+// at most max times, unless max is 0, and so reset is called before the
+// first value given is added, unless it is nil
+func wrapSlice(value flag.Value, names string, max int, reset func()) flag.Value {
+	if max <= 0 && reset == nil {
+		return value
+	}
+	name := strings.Trim(strings.Split(names, ",")[0], " ")
+	return &sliceOptions{Value: value, name: prefixFor(name) + name, max: max, reset: reset}
+}
+
+func (o *sliceOptions) unwrap() flag.Value {
+	return o.Value
+}
+
+// fileLines wraps the value of a slice flag with FromLines set, so each value
+// given is a file whose lines are added to the slice
+type fileLines struct {
+	flag.Value
+}
+
+func (l *fileLines) Set(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if err := l.Value.Set(line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *fileLines) unwrap() flag.Value {
+	return l.Value
+}
+
+// Returns the value of a flag without the wrappers of wrapSlice,
+// FromLines and NormalizedFlag
+func unwrapValue(value flag.Value) flag.Value {
+	for {
+		w, ok := value.(interface {
+			unwrap() flag.Value
+		})
+		if !ok {
+			return value
+		}
+		value = w.unwrap()
+	}
+}
+
 type IntSlice []int
 
 func (f *IntSlice) Set(value string) error {
@@ -132,6 +595,10 @@ type IntSliceFlag struct {
 	Name  string
 	Value *IntSlice
 	Usage string
+	// The most times the flag can be given, 0 for no limit
+	MaxItems int
+	// Whether the values given replace those of Value rather than add to them
+	ReplaceDefaults bool
 }
 
 func (f IntSliceFlag) String() string {
@@ -141,8 +608,19 @@ func (f IntSliceFlag) String() string {
 }
 
 func (f IntSliceFlag) Apply(set *flag.FlagSet) {
+	values := f.Value
+	if values == nil {
+		values = &IntSlice{}
+	}
+	var reset func()
+	if f.ReplaceDefaults {
+		defaults := append(IntSlice{}, *values...)
+		values = &defaults
+		reset = func() { *values = nil }
+	}
+	value := wrapSlice(values, f.Name, f.MaxItems, reset)
 	eachName(f.Name, func(name string) {
-		set.Var(f.Value, name, f.Usage)
+		set.Var(value, name, f.Usage)
 	})
 }
 
@@ -150,113 +628,990 @@ func (f IntSliceFlag) getName() string {
 	return f.Name
 }
 
-type BoolFlag struct {
+type UintSlice []uint
+
+func (f *UintSlice) Set(value string) error {
+	tmp, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, uint(tmp))
+	return nil
+}
+
+func (f *UintSlice) String() string {
+	return fmt.Sprintf("%d", *f)
+}
+
+func (f *UintSlice) Value() []uint {
+	return *f
+}
+
+type UintSliceFlag struct {
 	Name  string
+	Value *UintSlice
 	Usage string
 }
 
-func (f BoolFlag) String() string {
-	return fmt.Sprintf("%s\t%v", prefixedNames(f.Name), f.Usage)
+// Creates a UintSliceFlag whose values are appended to the given defaults
+func NewUintSliceFlag(name string, value []uint, usage string) UintSliceFlag {
+	slice := UintSlice(value)
+	return UintSliceFlag{Name: name, Value: &slice, Usage: usage}
 }
 
-func (f BoolFlag) Apply(set *flag.FlagSet) {
+func (f UintSliceFlag) String() string {
+	firstName := strings.Trim(strings.Split(f.Name, ",")[0], " ")
+	pref := prefixFor(firstName)
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" option "+pref+firstName+" option", f.Usage)
+}
+
+func (f UintSliceFlag) Apply(set *flag.FlagSet) {
+	if f.Value == nil {
+		f.Value = &UintSlice{}
+	}
 	eachName(f.Name, func(name string) {
-		set.Bool(name, false, f.Usage)
+		set.Var(f.Value, name, f.Usage)
 	})
 }
 
-func (f BoolFlag) getName() string {
+func (f UintSliceFlag) getName() string {
 	return f.Name
 }
 
-type BoolTFlag struct {
+// KeyValue is a single key=value pair collected by a KeyValueSliceFlag
+type KeyValue struct {
+	Key   string
+	Value string
+}
+
+// KeyValueSlice holds key=value pairs in the order they were given,
+// including duplicate keys
+type KeyValueSlice []KeyValue
+
+func (f *KeyValueSlice) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Expected key=value, got %q", value)
+	}
+	*f = append(*f, KeyValue{Key: parts[0], Value: parts[1]})
+	return nil
+}
+
+func (f *KeyValueSlice) String() string {
+	pairs := make([]string, len(*f))
+	for i, kv := range *f {
+		pairs[i] = kv.Key + "=" + kv.Value
+	}
+	return fmt.Sprintf("%s", pairs)
+}
+
+func (f *KeyValueSlice) Value() []KeyValue {
+	return *f
+}
+
+type KeyValueSliceFlag struct {
 	Name  string
+	Value *KeyValueSlice
 	Usage string
 }
 
-func (f BoolTFlag) String() string {
-	return fmt.Sprintf("%s\t%v", prefixedNames(f.Name), f.Usage)
+// Creates a KeyValueSliceFlag whose pairs are appended to the given defaults
+func NewKeyValueSliceFlag(name string, value []KeyValue, usage string) KeyValueSliceFlag {
+	slice := KeyValueSlice(value)
+	return KeyValueSliceFlag{Name: name, Value: &slice, Usage: usage}
 }
 
-func (f BoolTFlag) Apply(set *flag.FlagSet) {
+func (f KeyValueSliceFlag) String() string {
+	firstName := strings.Trim(strings.Split(f.Name, ",")[0], " ")
+	pref := prefixFor(firstName)
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" key=value "+pref+firstName+" key=value", f.Usage)
+}
+
+func (f KeyValueSliceFlag) Apply(set *flag.FlagSet) {
+	if f.Value == nil {
+		f.Value = &KeyValueSlice{}
+	}
 	eachName(f.Name, func(name string) {
-		set.Bool(name, true, f.Usage)
+		set.Var(f.Value, name, f.Usage)
 	})
 }
 
-func (f BoolTFlag) getName() string {
+func (f KeyValueSliceFlag) getName() string {
 	return f.Name
 }
 
-type StringFlag struct {
-	Name  string
-	Value string
-	Usage string
+// StringMap holds key=value pairs by key, a later value for a key replacing
+// the earlier one. It remembers the order keys were first given in, see Keys.
+type StringMap struct {
+	values map[string]string
+	keys   []string
 }
 
-func (f StringFlag) String() string {
-	var fmtString string
-	fmtString = "%s %v\t%v"
+// Creates a StringMap holding the given pairs, with the keys in sorted order
+func NewStringMap(values map[string]string) *StringMap {
+	m := &StringMap{}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		m.put(key, values[key])
+	}
+	return m
+}
 
-	if len(f.Value) > 0 {
-		fmtString = "%s '%v'\t%v"
-	} else {
-		fmtString = "%s %v\t%v"
+func (m *StringMap) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Expected key=value, got %q", value)
 	}
+	m.put(parts[0], parts[1])
+	return nil
+}
 
-	return fmt.Sprintf(fmtString, prefixedNames(f.Name), f.Value, f.Usage)
+func (m *StringMap) put(key, value string) {
+	if m.values == nil {
+		m.values = make(map[string]string)
+	}
+	if _, ok := m.values[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+	m.values[key] = value
 }
 
-func (f StringFlag) Apply(set *flag.FlagSet) {
-	eachName(f.Name, func(name string) {
-		set.String(name, f.Value, f.Usage)
-	})
+// Lists the pairs in the order of Keys
+func (m *StringMap) String() string {
+	pairs := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		pairs[i] = key + "=" + m.values[key]
+	}
+	return fmt.Sprintf("%s", pairs)
 }
 
-func (f StringFlag) getName() string {
-	return f.Name
+// Returns a copy of the pairs. Iterate over Keys for a stable order.
+func (m *StringMap) Value() map[string]string {
+	values := make(map[string]string, len(m.values))
+	for key, value := range m.values {
+		values[key] = value
+	}
+	return values
 }
 
-type IntFlag struct {
+// Returns the keys in the order they were first given in
+func (m *StringMap) Keys() []string {
+	return append([]string{}, m.keys...)
+}
+
+type StringMapFlag struct {
 	Name  string
-	Value int
+	Value *StringMap
 	Usage string
 }
 
-func (f IntFlag) String() string {
-	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+// Creates a StringMapFlag whose pairs are added to the given defaults
+func NewStringMapFlag(name string, value map[string]string, usage string) StringMapFlag {
+	return StringMapFlag{Name: name, Value: NewStringMap(value), Usage: usage}
 }
 
-func (f IntFlag) Apply(set *flag.FlagSet) {
+func (f StringMapFlag) String() string {
+	firstName := strings.Trim(strings.Split(f.Name, ",")[0], " ")
+	pref := prefixFor(firstName)
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" key=value "+pref+firstName+" key=value", f.Usage)
+}
+
+func (f StringMapFlag) Apply(set *flag.FlagSet) {
+	if f.Value == nil {
+		f.Value = &StringMap{}
+	}
 	eachName(f.Name, func(name string) {
-		set.Int(name, f.Value, f.Usage)
+		set.Var(f.Value, name, f.Usage)
 	})
 }
 
-func (f IntFlag) getName() string {
+func (f StringMapFlag) getName() string {
 	return f.Name
 }
 
-type Float64Flag struct {
+type BoolFlag struct {
 	Name  string
-	Value float64
 	Usage string
 }
 
-func (f Float64Flag) String() string {
-	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+func (f BoolFlag) String() string {
+	return fmt.Sprintf("%s\t%v", prefixedNames(f.Name), f.Usage)
 }
 
-func (f Float64Flag) Apply(set *flag.FlagSet) {
+func (f BoolFlag) Apply(set *flag.FlagSet) {
 	eachName(f.Name, func(name string) {
-		set.Float64(name, f.Value, f.Usage)
+		set.Bool(name, false, f.Usage)
 	})
 }
 
-func (f Float64Flag) getName() string {
+func (f BoolFlag) getName() string {
+	return f.Name
+}
+
+type BoolTFlag struct {
+	Name  string
+	Usage string
+}
+
+func (f BoolTFlag) String() string {
+	return fmt.Sprintf("%s\t%v", prefixedNames(f.Name), f.Usage)
+}
+
+func (f BoolTFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Bool(name, true, f.Usage)
+	})
+}
+
+func (f BoolTFlag) getName() string {
+	return f.Name
+}
+
+// CountFlag is a flag that takes no value and counts how many times it is
+// given, such as -vvv for a verbosity of 3. See Context.Count.
+type CountFlag struct {
+	Name  string
+	Usage string
+}
+
+func (f CountFlag) String() string {
+	return fmt.Sprintf("%s\t%v", prefixedNames(f.Name), f.Usage)
+}
+
+func (f CountFlag) Apply(set *flag.FlagSet) {
+	count := new(counter)
+	eachName(f.Name, func(name string) {
+		set.Var(count, name, f.Usage)
+	})
+}
+
+func (f CountFlag) getName() string {
+	return f.Name
+}
+
+// counter is the value of a CountFlag, shared by all of its names
+type counter int
+
+func (c *counter) Set(value string) error {
+	v, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+	if v {
+		*c++
+	}
+	return nil
+}
+
+func (c *counter) String() string {
+	return strconv.Itoa(int(*c))
+}
+
+func (c *counter) IsBoolFlag() bool {
+	return true
+}
+
+// Splits clusters of single letter flags, such as -vvv or -xf, into separate
+// flags. The last flag of a cluster may take a value, attached as in -ojson
+// or -vo=json, or given as the next argument. Like the flag package it stops
+// at the first argument that is neither a flag nor the value of one, or at a
+// "--".
+func expandShortFlags(args []string, set *flag.FlagSet) []string {
+	var expanded []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" || len(arg) < 2 || arg[0] != '-' {
+			return append(expanded, args[i:]...)
+		}
+		if flags, needsValue, ok := splitShortFlags(arg, set); ok {
+			expanded = append(expanded, flags...)
+			if needsValue && i+1 < len(args) {
+				i++
+				expanded = append(expanded, args[i])
+			}
+			continue
+		}
+		expanded = append(expanded, arg)
+
+		// skip the value of a flag given as "-name value"
+		name := strings.TrimLeft(arg, "-")
+		if f := set.Lookup(name); f != nil && !strings.Contains(name, "=") && !isBoolValue(f.Value) && i+1 < len(args) {
+			i++
+			expanded = append(expanded, args[i])
+		}
+	}
+	return expanded
+}
+
+// Splits arg into the single letter flags it clusters, or reports false when
+// it is not such a cluster. A flag taking a value ends the cluster, and
+// needsValue reports whether its value is the next argument.
+func splitShortFlags(arg string, set *flag.FlagSet) (flags []string, needsValue bool, ok bool) {
+	if len(arg) < 3 || arg[0] != '-' || arg[1] == '-' {
+		return nil, false, false
+	}
+	name := arg[1:]
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[:i]
+	}
+	if len(name) < 2 || set.Lookup(name) != nil {
+		return nil, false, false
+	}
+	rest := arg[1:]
+	for _, r := range name {
+		letter := string(r)
+		f := set.Lookup(letter)
+		if f == nil {
+			return nil, false, false
+		}
+		rest = rest[len(letter):]
+		switch {
+		case strings.HasPrefix(rest, "="):
+			return append(flags, "-"+letter+rest), false, true
+		case !isBoolValue(f.Value) && rest == "":
+			return append(flags, "-"+letter), true, true
+		case !isBoolValue(f.Value):
+			return append(flags, "-"+letter, rest), false, true
+		}
+		flags = append(flags, "-"+letter)
+	}
+	return flags, false, true
+}
+
+// Reports whether a flag with value v takes no argument
+func isBoolValue(v flag.Value) bool {
+	b, ok := v.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+type StringFlag struct {
+	Name  string
+	Value string
+	Usage string
+}
+
+func (f StringFlag) String() string {
+	var fmtString string
+	fmtString = "%s %v\t%v"
+
+	if len(f.Value) > 0 {
+		fmtString = "%s '%v'\t%v"
+	} else {
+		fmtString = "%s %v\t%v"
+	}
+
+	return fmt.Sprintf(fmtString, prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f StringFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.String(name, f.Value, f.Usage)
+	})
+}
+
+func (f StringFlag) getName() string {
 	return f.Name
 }
 
+// DerivedStringFlag is a string flag whose default is computed from the
+// context once parsing is done, so it can refer to the values of other flags.
+// DefaultFunc is only called when the flag was not given.
+type DerivedStringFlag struct {
+	Name        string
+	DefaultFunc func(ctx *Context) string
+	Usage       string
+}
+
+func (f DerivedStringFlag) String() string {
+	return fmt.Sprintf("%s \t%v", prefixedNames(f.Name), f.Usage)
+}
+
+func (f DerivedStringFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.String(name, "", f.Usage)
+	})
+}
+
+func (f DerivedStringFlag) getName() string {
+	return f.Name
+}
+
+// NormalizedFlag passes every value given to Flag through Normalize before
+// Flag parses it, such as to trim or lowercase it. Normalize is called once
+// for each time a slice flag is given.
+type NormalizedFlag struct {
+	Flag
+	Normalize func(value string) string
+}
+
+func (f NormalizedFlag) Apply(set *flag.FlagSet) {
+	f.Flag.Apply(set)
+	if f.Normalize == nil {
+		return
+	}
+	// names sharing a value, such as those of slice flags, share one wrapper
+	var wrapped []*normalizedValue
+	eachName(f.getName(), func(name string) {
+		ff := set.Lookup(name)
+		if ff == nil {
+			return
+		}
+		for _, value := range wrapped {
+			if value.Value == ff.Value {
+				ff.Value = value
+				return
+			}
+		}
+		value := &normalizedValue{Value: ff.Value, normalize: f.Normalize}
+		wrapped = append(wrapped, value)
+		ff.Value = value
+	})
+}
+
+func (f NormalizedFlag) wrapped() Flag {
+	return f.Flag
+}
+
+// normalizedValue passes the values given to the value it wraps through
+// normalize
+type normalizedValue struct {
+	flag.Value
+	normalize func(string) string
+}
+
+func (v *normalizedValue) Set(value string) error {
+	return v.Value.Set(v.normalize(value))
+}
+
+func (v *normalizedValue) Get() interface{} {
+	if getter, ok := v.Value.(flag.Getter); ok {
+		return getter.Get()
+	}
+	return v.Value.String()
+}
+
+func (v *normalizedValue) IsBoolFlag() bool {
+	return isBoolValue(v.Value)
+}
+
+func (v *normalizedValue) unwrap() flag.Value {
+	return v.Value
+}
+
+// OrderedFlag places Flag in help by DisplayOrder: ordered flags are listed
+// first, lowest DisplayOrder first, and flags of equal order or without one
+// keep the order they were registered in.
+type OrderedFlag struct {
+	Flag
+	DisplayOrder int
+}
+
+func (f OrderedFlag) wrapped() Flag {
+	return f.Flag
+}
+
+// SecretFlag shows *** instead of the value of Flag in help, parse errors
+// and the debug command, such as for a password or a token given as a
+// StringFlag
+type SecretFlag struct {
+	Flag
+}
+
+func (f SecretFlag) String() string {
+	text := f.Flag.String()
+	set := flag.NewFlagSet("", flag.ContinueOnError)
+	f.Flag.Apply(set)
+	ff := set.Lookup(firstName(f.Flag))
+	names := prefixedNames(f.getName())
+	if ff == nil || ff.DefValue == "" || !strings.HasPrefix(text, names) {
+		return text
+	}
+	// only the value after the names, not the usage, is redacted
+	parts := strings.SplitN(text[len(names):], "\t", 2)
+	parts[0] = strings.Replace(parts[0], ff.DefValue, redacted, -1)
+	return names + strings.Join(parts, "\t")
+}
+
+func (f SecretFlag) isSecret() bool {
+	return true
+}
+
+func (f SecretFlag) wrapped() Flag {
+	return f.Flag
+}
+
+// AliasFlag is a hidden name for the flag named AliasOf, such as an old name
+// kept working after a rename. Giving it sets the canonical flag, which is
+// then set as far as IsSet is concerned, and it is left out of help.
+type AliasFlag struct {
+	Name    string
+	AliasOf string
+}
+
+func (f AliasFlag) String() string {
+	return fmt.Sprintf("%s\talias of %s", prefixedNames(f.Name), prefixedNames(f.AliasOf))
+}
+
+func (f AliasFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Var(&aliasValue{set: set, name: f.AliasOf}, name, "")
+	})
+}
+
+func (f AliasFlag) getName() string {
+	return f.Name
+}
+
+func (f AliasFlag) hidden() bool {
+	return true
+}
+
+// aliasValue forwards to the value of the named flag of set
+type aliasValue struct {
+	set  *flag.FlagSet
+	name string
+}
+
+func (v *aliasValue) Set(value string) error {
+	return v.set.Set(v.name, value)
+}
+
+func (v *aliasValue) String() string {
+	if f := v.set.Lookup(v.name); f != nil {
+		return f.Value.String()
+	}
+	return ""
+}
+
+func (v *aliasValue) Get() interface{} {
+	if f := v.set.Lookup(v.name); f != nil {
+		if getter, ok := f.Value.(flag.Getter); ok {
+			return getter.Get()
+		}
+	}
+	return nil
+}
+
+func (v *aliasValue) IsBoolFlag() bool {
+	f := v.set.Lookup(v.name)
+	return f != nil && isBoolValue(f.Value)
+}
+
+// Completes the flag set of ctx once the command line is parsed: flags that
+// are not on the command line are added, the flags that were not given are
+// set from the environment then from the config files, and last the computed
+// default of each DerivedStringFlag that was not given is set. None of these
+// mark the flag as set.
+func resolveFlags(flags []Flag, ctx *Context) error {
+	for _, f := range flags {
+		if !onCommandLine(f) {
+			f.Apply(ctx.flagSet)
+		}
+	}
+
+	for _, f := range flags {
+		if envVars := flagEnvVars(f); envVars != "" {
+			if _, set := lookupEnv(envVars); set {
+				var names []string
+				eachName(f.getName(), func(name string) {
+					names = append(names, name)
+				})
+				ctx.setSource(names, "env")
+			}
+		}
+	}
+
+	if ctx.App != nil && ctx.App.EnvPrefix != "" {
+		if err := applyEnvPrefix(flags, ctx, ctx.App.EnvPrefix); err != nil {
+			return err
+		}
+	}
+
+	if err := applyConfig(flags, ctx); err != nil {
+		return err
+	}
+
+	for _, f := range flags {
+		derived, ok := unwrapFlag(f).(DerivedStringFlag)
+		if !ok || derived.DefaultFunc == nil {
+			continue
+		}
+
+		given := false
+		eachName(derived.Name, func(name string) {
+			given = given || ctx.IsSet(name)
+		})
+		if given {
+			continue
+		}
+
+		value := derived.DefaultFunc(ctx)
+		eachName(derived.Name, func(name string) {
+			if ff := ctx.flagSet.Lookup(name); ff != nil {
+				ff.Value.Set(value)
+			}
+		})
+	}
+	return nil
+}
+
+// Sets the flags that were not given on the command line from the environment
+// variables named after them, such as APP_LOG_LEVEL for --log-level with the
+// prefix APP. Flags with an EnvVar of their own are left alone.
+func applyEnvPrefix(flags []Flag, ctx *Context, prefix string) error {
+	for _, f := range flags {
+		if f.getName() == HelpFlag.Name || f.getName() == VersionFlag.Name || f.getName() == BashCompletionFlag.Name {
+			continue
+		}
+		if _, ok := unwrapFlag(f).(AliasFlag); ok {
+			continue
+		}
+		if flagEnvVars(f) != "" {
+			continue
+		}
+
+		var names []string
+		given := false
+		eachName(f.getName(), func(name string) {
+			names = append(names, name)
+			given = given || ctx.IsSet(name)
+		})
+		envVar := prefixedEnvVar(prefix, f.getName())
+		env := os.Getenv(envVar)
+		if given || env == "" {
+			continue
+		}
+
+		if err := setFlag(ctx.flagSet, names, []string{env}); err != nil {
+			return fmt.Errorf("invalid value %q for $%s: %v", env, envVar, err)
+		}
+		ctx.setSource(names, "env")
+	}
+	return nil
+}
+
+// Returns the environment variable named after the first of names with the
+// prefix, such as APP_LOG_LEVEL for "log-level"
+func prefixedEnvVar(prefix, names string) string {
+	name := strings.Trim(strings.Split(names, ",")[0], " ")
+	return strings.TrimSuffix(prefix, "_") + "_" + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+}
+
+// Sets each of values, in order, to the flag with the given names without
+// marking it as set. Names sharing a value, such as those of slice flags, are
+// set once.
+func setFlag(set *flag.FlagSet, names []string, values []string) error {
+	var applied []flag.Value
+names:
+	for _, name := range names {
+		ff := set.Lookup(name)
+		if ff == nil {
+			continue
+		}
+		for _, value := range applied {
+			if value == ff.Value {
+				continue names
+			}
+		}
+		for _, value := range values {
+			if err := ff.Value.Set(value); err != nil {
+				return err
+			}
+		}
+		applied = append(applied, ff.Value)
+	}
+	return nil
+}
+
+// EnvStringFlag is a string flag that falls back to the value of the EnvVar
+// environment variable, then to Value, when it is not given. EnvVar can list
+// several comma separated variables, the first one set is used. With
+// NoCommandLine set it can only be set from the environment: it is neither
+// parsed from the command line nor shown in help.
+type EnvStringFlag struct {
+	Name          string
+	Value         string
+	Usage         string
+	EnvVar        string
+	NoCommandLine bool
+	// Show *** instead of the value in help and parse errors
+	Secret bool
+}
+
+func (f EnvStringFlag) String() string {
+	value := f.Value
+	if f.Secret {
+		value = redact(value)
+	}
+	return StringFlag{f.Name, value, f.Usage}.String() + envHint(f.EnvVar)
+}
+
+func (f EnvStringFlag) Apply(set *flag.FlagSet) {
+	value := f.Value
+	if env, ok := lookupEnv(f.EnvVar); ok {
+		value = env
+	}
+	eachName(f.Name, func(name string) {
+		set.String(name, value, f.Usage)
+	})
+}
+
+func (f EnvStringFlag) getName() string {
+	return f.Name
+}
+
+func (f EnvStringFlag) onCommandLine() bool {
+	return !f.NoCommandLine
+}
+
+func (f EnvStringFlag) isSecret() bool {
+	return f.Secret
+}
+
+func (f EnvStringFlag) envVars() string {
+	return f.EnvVar
+}
+
+// Returns the value of the first of the comma separated environment
+// variables that is set and not empty
+func lookupEnv(envVars string) (string, bool) {
+	if envVars == "" {
+		return "", false
+	}
+	value, found := "", false
+	eachName(envVars, func(name string) {
+		if env := os.Getenv(name); !found && env != "" {
+			value, found = env, true
+		}
+	})
+	return value, found
+}
+
+// Lists the comma separated environment variables of a flag for its help
+func envHint(envVars string) string {
+	if envVars == "" {
+		return ""
+	}
+	var names []string
+	eachName(envVars, func(name string) {
+		names = append(names, "$"+name)
+	})
+	return " [" + strings.Join(names, ", ") + "]"
+}
+
+type IntFlag struct {
+	Name  string
+	Value int
+	Usage string
+}
+
+func (f IntFlag) String() string {
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f IntFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Int(name, f.Value, f.Usage)
+	})
+}
+
+func (f IntFlag) getName() string {
+	return f.Name
+}
+
+type Float64Flag struct {
+	Name  string
+	Value float64
+	Usage string
+}
+
+func (f Float64Flag) String() string {
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f Float64Flag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Float64(name, f.Value, f.Usage)
+	})
+}
+
+func (f Float64Flag) getName() string {
+	return f.Name
+}
+
+type Int64Flag struct {
+	Name  string
+	Value int64
+	Usage string
+}
+
+func (f Int64Flag) String() string {
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f Int64Flag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Int64(name, f.Value, f.Usage)
+	})
+}
+
+func (f Int64Flag) getName() string {
+	return f.Name
+}
+
+type UintFlag struct {
+	Name  string
+	Value uint
+	Usage string
+}
+
+func (f UintFlag) String() string {
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f UintFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Uint(name, f.Value, f.Usage)
+	})
+}
+
+func (f UintFlag) getName() string {
+	return f.Name
+}
+
+type Uint64Flag struct {
+	Name  string
+	Value uint64
+	Usage string
+}
+
+func (f Uint64Flag) String() string {
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f Uint64Flag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		set.Uint64(name, f.Value, f.Usage)
+	})
+}
+
+func (f Uint64Flag) getName() string {
+	return f.Name
+}
+
+type DurationFlag struct {
+	Name  string
+	Value time.Duration
+	Usage string
+	// Rejects negative durations, which make no sense for a timeout or an
+	// interval
+	NonNegative bool
+}
+
+func (f DurationFlag) String() string {
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), f.Value, f.Usage)
+}
+
+func (f DurationFlag) Apply(set *flag.FlagSet) {
+	eachName(f.Name, func(name string) {
+		if f.NonNegative {
+			d := nonNegativeDuration(f.Value)
+			set.Var(&d, name, f.Usage)
+			return
+		}
+		set.Duration(name, f.Value, f.Usage)
+	})
+}
+
+func (f DurationFlag) getName() string {
+	return f.Name
+}
+
+// The flag value of a DurationFlag with NonNegative set
+type nonNegativeDuration time.Duration
+
+func (d *nonNegativeDuration) Set(value string) error {
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	if duration < 0 {
+		return fmt.Errorf("Invalid duration %q: must not be negative", value)
+	}
+	*d = nonNegativeDuration(duration)
+	return nil
+}
+
+func (d *nonNegativeDuration) String() string {
+	return time.Duration(*d).String()
+}
+
+func (d *nonNegativeDuration) Get() interface{} {
+	return time.Duration(*d)
+}
+
+type TimestampFlag struct {
+	Name  string
+	Usage string
+	// The layouts of time.Parse tried in order, the first that parses the
+	// value giving the time. Empty means time.RFC3339.
+	Layouts []string
+}
+
+func (f TimestampFlag) String() string {
+	return fmt.Sprintf("%s \t%v", prefixedNames(f.Name), f.Usage)
+}
+
+func (f TimestampFlag) Apply(set *flag.FlagSet) {
+	layouts := f.Layouts
+	if len(layouts) == 0 {
+		layouts = []string{time.RFC3339}
+	}
+	// the names share one value, as formatting the time with the first
+	// layout to copy it to the other names could lose part of it
+	value := &timestamp{layouts: layouts}
+	eachName(f.Name, func(name string) {
+		set.Var(value, name, f.Usage)
+	})
+}
+
+func (f TimestampFlag) getName() string {
+	return f.Name
+}
+
+// The flag value of a TimestampFlag
+type timestamp struct {
+	layouts []string
+	time    time.Time
+}
+
+func (t *timestamp) Set(value string) error {
+	for _, layout := range t.layouts {
+		if parsed, err := time.Parse(layout, value); err == nil {
+			t.time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid timestamp %q: expected a time such as %s", value, strings.Join(t.layouts, " or "))
+}
+
+func (t *timestamp) String() string {
+	if t.time.IsZero() {
+		return ""
+	}
+	return t.time.Format(t.layouts[0])
+}
+
+func (t *timestamp) Get() interface{} {
+	return t.time
+}
+
 func prefixFor(name string) (prefix string) {
 	if len(name) == 1 {
 		prefix = "-"
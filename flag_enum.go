@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+)
+
+// EnumSlice is a Generic flag value holding a list of values that must each be
+// one of Allowed. Each time the flag is given its value is split on commas,
+// so --features a,b --features c collects a, b and c.
+type EnumSlice struct {
+	// The values the items may take
+	Allowed []string
+	values  []string
+}
+
+func (e *EnumSlice) Set(value string) error {
+	var values []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !e.allows(item) {
+			return fmt.Errorf("Unknown value %q in %q: expected any of %s", item, value, strings.Join(e.Allowed, ", "))
+		}
+		values = append(values, item)
+	}
+	e.values = append(e.values, values...)
+	return nil
+}
+
+func (e *EnumSlice) String() string {
+	return strings.Join(e.values, ",")
+}
+
+func (e *EnumSlice) Value() []string {
+	return e.values
+}
+
+func (e *EnumSlice) allows(item string) bool {
+	for _, allowed := range e.Allowed {
+		if item == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// Creates a GenericFlag for a comma separated list of values that must each
+// be one of allowed, such as --features a,b,c
+func NewEnumSliceFlag(name string, allowed []string, usage string) GenericFlag {
+	return GenericFlag{Name: name, Value: &EnumSlice{Allowed: allowed}, Usage: usage}
+}
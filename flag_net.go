@@ -0,0 +1,133 @@
+package cli
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// IP is a Generic flag value holding an IP address
+type IP net.IP
+
+func (i *IP) Set(value string) error {
+	ip := net.ParseIP(value)
+	if ip == nil {
+		return fmt.Errorf("Invalid IP address: %q", value)
+	}
+	*i = IP(ip)
+	return nil
+}
+
+func (i *IP) String() string {
+	if len(*i) == 0 {
+		return ""
+	}
+	return net.IP(*i).String()
+}
+
+func (i *IP) Value() net.IP {
+	if len(*i) == 0 {
+		return nil
+	}
+	return net.IP(*i)
+}
+
+// Creates a GenericFlag for an IP address, such as 10.0.0.1 or ::1
+func NewIPFlag(name string, value net.IP, usage string) GenericFlag {
+	ip := IP(value)
+	return GenericFlag{Name: name, Value: &ip, Usage: usage}
+}
+
+// IPNet is a Generic flag value holding a network in CIDR notation
+type IPNet net.IPNet
+
+func (n *IPNet) Set(value string) error {
+	_, ipnet, err := net.ParseCIDR(value)
+	if err != nil {
+		return fmt.Errorf("Invalid CIDR network: %q", value)
+	}
+	*n = IPNet(*ipnet)
+	return nil
+}
+
+func (n *IPNet) String() string {
+	if n.IP == nil {
+		return ""
+	}
+	return (*net.IPNet)(n).String()
+}
+
+func (n *IPNet) Value() *net.IPNet {
+	if n.IP == nil {
+		return nil
+	}
+	return (*net.IPNet)(n)
+}
+
+// Creates a GenericFlag for a network in CIDR notation, such as 10.0.0.0/24
+func NewIPNetFlag(name string, value *net.IPNet, usage string) GenericFlag {
+	ipnet := IPNet{}
+	if value != nil {
+		ipnet = IPNet(*value)
+	}
+	return GenericFlag{Name: name, Value: &ipnet, Usage: usage}
+}
+
+// The schemes a URL flag accepts when none are given to NewURLFlag
+var DefaultURLSchemes = []string{"http", "https"}
+
+// URL is a Generic flag value holding an absolute URL whose scheme is one of
+// a set of allowed schemes
+type URL struct {
+	url     *url.URL
+	schemes []string
+}
+
+func (u *URL) Set(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("Invalid URL: %q", value)
+	}
+	schemes := u.schemes
+	// only the default schemes are known to have a host
+	if parsed.Scheme == "" || parsed.Host == "" && len(schemes) == 0 {
+		return fmt.Errorf("Invalid URL: %q is not an absolute URL", value)
+	}
+
+	if len(schemes) == 0 {
+		schemes = DefaultURLSchemes
+	}
+	for _, scheme := range schemes {
+		if strings.EqualFold(parsed.Scheme, scheme) {
+			u.url = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("Invalid URL: scheme %q is not one of %s", parsed.Scheme, strings.Join(schemes, ", "))
+}
+
+func (u *URL) String() string {
+	if u.url == nil {
+		return ""
+	}
+	return u.url.String()
+}
+
+func (u *URL) Value() *url.URL {
+	return u.url
+}
+
+// Creates a GenericFlag for a URL. The URL must use one of the given schemes,
+// or one of DefaultURLSchemes when none are given, in which case it must also
+// name a host. Given schemes may have none, as in "file:///etc/hosts". An
+// invalid default value is a programming error, so it panics.
+func NewURLFlag(name, value, usage string, schemes ...string) GenericFlag {
+	u := &URL{schemes: schemes}
+	if value != "" {
+		if err := u.Set(value); err != nil {
+			panic(err)
+		}
+	}
+	return GenericFlag{Name: name, Value: u, Usage: usage}
+}
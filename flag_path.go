@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Expands a leading ~ to the home directory of the current user, as found by
+// HomeDir, and cleans the path
+func expandPath(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if value == "~" || strings.HasPrefix(value, "~/") {
+		home, err := HomeDir()
+		if err != nil {
+			return "", err
+		}
+		value = home + value[1:]
+	}
+	return filepath.Clean(value), nil
+}
+
+// Path is a Generic flag value holding a file system path. A leading ~ is
+// expanded to the home directory and the path is cleaned.
+type Path string
+
+func (p *Path) Set(value string) error {
+	path, err := expandPath(value)
+	if err != nil {
+		return err
+	}
+	*p = Path(path)
+	return nil
+}
+
+func (p *Path) String() string {
+	return string(*p)
+}
+
+func (p *Path) Value() string {
+	return string(*p)
+}
+
+// Creates a GenericFlag for a file system path, such as ~/.config/app. The
+// default value is expanded the same way as given values when possible.
+func NewPathFlag(name string, value string, usage string) GenericFlag {
+	path := Path(value)
+	if expanded, err := expandPath(value); err == nil {
+		path = Path(expanded)
+	}
+	return GenericFlag{Name: name, Value: &path, Usage: usage}
+}
+
+// PathSlice is a list of file system paths, each expanded like a Path
+type PathSlice []string
+
+func (f *PathSlice) Set(value string) error {
+	path, err := expandPath(value)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, path)
+	return nil
+}
+
+func (f *PathSlice) String() string {
+	return fmt.Sprintf("%s", *f)
+}
+
+func (f *PathSlice) Value() []string {
+	return *f
+}
+
+type PathSliceFlag struct {
+	Name  string
+	Value *PathSlice
+	Usage string
+}
+
+// Creates a PathSliceFlag whose values are appended to the given defaults
+func NewPathSliceFlag(name string, value []string, usage string) PathSliceFlag {
+	slice := PathSlice(value)
+	return PathSliceFlag{Name: name, Value: &slice, Usage: usage}
+}
+
+func (f PathSliceFlag) String() string {
+	firstName := strings.Trim(strings.Split(f.Name, ",")[0], " ")
+	pref := prefixFor(firstName)
+	return fmt.Sprintf("%s '%v'\t%v", prefixedNames(f.Name), pref+firstName+" option "+pref+firstName+" option", f.Usage)
+}
+
+func (f PathSliceFlag) Apply(set *flag.FlagSet) {
+	if f.Value == nil {
+		f.Value = &PathSlice{}
+	}
+	eachName(f.Name, func(name string) {
+		set.Var(f.Value, name, f.Usage)
+	})
+}
+
+func (f PathSliceFlag) getName() string {
+	return f.Name
+}
@@ -0,0 +1,157 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The flag types of a flag spec, see ParseFlagSpec
+var flagSpecTypes = map[string]func(name, value, usage string, hasValue bool) (Flag, error){
+	"string": func(name, value, usage string, hasValue bool) (Flag, error) {
+		return StringFlag{Name: name, Value: value, Usage: usage}, nil
+	},
+	"int": func(name, value, usage string, hasValue bool) (Flag, error) {
+		n, err := parseSpecValue(value, hasValue, 0, func(s string) (interface{}, error) {
+			n, err := strconv.ParseInt(s, 0, 0)
+			return int(n), err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return IntFlag{Name: name, Value: n.(int), Usage: usage}, nil
+	},
+	"int64": func(name, value, usage string, hasValue bool) (Flag, error) {
+		n, err := parseSpecValue(value, hasValue, int64(0), func(s string) (interface{}, error) { return strconv.ParseInt(s, 0, 64) })
+		if err != nil {
+			return nil, err
+		}
+		return Int64Flag{Name: name, Value: n.(int64), Usage: usage}, nil
+	},
+	"uint": func(name, value, usage string, hasValue bool) (Flag, error) {
+		n, err := parseSpecValue(value, hasValue, uint(0), func(s string) (interface{}, error) {
+			n, err := strconv.ParseUint(s, 0, 0)
+			return uint(n), err
+		})
+		if err != nil {
+			return nil, err
+		}
+		return UintFlag{Name: name, Value: n.(uint), Usage: usage}, nil
+	},
+	"uint64": func(name, value, usage string, hasValue bool) (Flag, error) {
+		n, err := parseSpecValue(value, hasValue, uint64(0), func(s string) (interface{}, error) { return strconv.ParseUint(s, 0, 64) })
+		if err != nil {
+			return nil, err
+		}
+		return Uint64Flag{Name: name, Value: n.(uint64), Usage: usage}, nil
+	},
+	"float64": func(name, value, usage string, hasValue bool) (Flag, error) {
+		n, err := parseSpecValue(value, hasValue, float64(0), func(s string) (interface{}, error) { return strconv.ParseFloat(s, 64) })
+		if err != nil {
+			return nil, err
+		}
+		return Float64Flag{Name: name, Value: n.(float64), Usage: usage}, nil
+	},
+	"bool": func(name, value, usage string, hasValue bool) (Flag, error) {
+		b, err := parseSpecValue(value, hasValue, false, func(s string) (interface{}, error) { return strconv.ParseBool(s) })
+		if err != nil {
+			return nil, err
+		}
+		if b.(bool) {
+			return BoolTFlag{Name: name, Usage: usage}, nil
+		}
+		return BoolFlag{Name: name, Usage: usage}, nil
+	},
+	"count": func(name, value, usage string, hasValue bool) (Flag, error) {
+		if hasValue {
+			return nil, fmt.Errorf("a count flag cannot have a default")
+		}
+		return CountFlag{Name: name, Usage: usage}, nil
+	},
+	"string-slice": func(name, value, usage string, hasValue bool) (Flag, error) {
+		values := StringSlice{}
+		if hasValue {
+			values = strings.Split(value, ",")
+		}
+		return StringSliceFlag{Name: name, Value: &values, Usage: usage}, nil
+	},
+	"int-slice": func(name, value, usage string, hasValue bool) (Flag, error) {
+		values := IntSlice{}
+		if hasValue {
+			for _, item := range strings.Split(value, ",") {
+				if err := values.Set(strings.TrimSpace(item)); err != nil {
+					return nil, fmt.Errorf("invalid default %q", value)
+				}
+			}
+		}
+		return IntSliceFlag{Name: name, Value: &values, Usage: usage}, nil
+	},
+}
+
+// Creates a flag from a spec of the form "type:name=default:usage", such as
+// "int:port, p=8080:the port to listen on". The default and the usage can be
+// left out, as in "bool:verbose". The types are string, int, int64, uint,
+// uint64, float64, bool, count, string-slice and int-slice. The default of a
+// slice is a comma separated list, and a bool defaulting to true gives a
+// BoolTFlag. The default ends at the first ':' not followed by a digit or a
+// '/', so that it can hold a host:port, a time of day or a URL.
+func ParseFlagSpec(spec string) (Flag, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("Invalid flag spec %q: expected type:name=default:usage", spec)
+	}
+
+	kind := strings.TrimSpace(parts[0])
+	create, ok := flagSpecTypes[kind]
+	if !ok {
+		return nil, fmt.Errorf("Invalid flag spec %q: unknown flag type %q", spec, kind)
+	}
+
+	name, value, usage := parts[1], "", ""
+	hasValue := false
+	if i := strings.IndexAny(name, "=:"); i >= 0 && name[i] == '=' {
+		name, value, hasValue = name[:i], name[i+1:], true
+		if j := specValueEnd(value); j >= 0 {
+			value, usage = value[:j], value[j+1:]
+		}
+	} else if i >= 0 {
+		name, usage = name[:i], name[i+1:]
+	}
+	name = strings.TrimSpace(name)
+	if strings.Trim(name, ", ") == "" {
+		return nil, fmt.Errorf("Invalid flag spec %q: missing flag name", spec)
+	}
+	usage = strings.TrimSpace(usage)
+
+	f, err := create(name, value, usage, hasValue)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid flag spec %q: %v", spec, err)
+	}
+	return f, nil
+}
+
+// Returns the index of the ':' ending the default at the start of s, or -1
+// when the default runs to its end
+func specValueEnd(s string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] != ':' {
+			continue
+		}
+		if i+1 == len(s) || s[i+1] != '/' && (s[i+1] < '0' || s[i+1] > '9') {
+			return i
+		}
+	}
+	return -1
+}
+
+// Parses the default of a flag spec, returning zero when there is none
+func parseSpecValue(value string, hasValue bool, zero interface{}, parse func(string) (interface{}, error)) (interface{}, error) {
+	if !hasValue {
+		return zero, nil
+	}
+	n, err := parse(strings.TrimSpace(value))
+	if err != nil {
+		return nil, fmt.Errorf("invalid default %q", value)
+	}
+	return n, nil
+}
@@ -3,10 +3,17 @@ package cli_test
 import (
 	"github.com/zenoss/cli"
 
+	"bytes"
 	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/url"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 var boolFlagTests = []struct {
@@ -97,13 +104,14 @@ func TestParseMultiString(t *testing.T) {
 		Flags: []cli.Flag{
 			cli.StringFlag{Name: "serve, s"},
 		},
-		Action: func(ctx *cli.Context) {
+		Action: func(ctx *cli.Context) error {
 			if ctx.String("serve") != "10" {
 				t.Errorf("main name not set")
 			}
 			if ctx.String("s") != "10" {
 				t.Errorf("short name not set")
 			}
+			return nil
 		},
 	}).Run([]string{"run", "-s", "10"})
 }
@@ -113,13 +121,14 @@ func TestParseMultiStringSlice(t *testing.T) {
 		Flags: []cli.Flag{
 			cli.StringSliceFlag{Name: "serve, s", Value: &cli.StringSlice{}},
 		},
-		Action: func(ctx *cli.Context) {
+		Action: func(ctx *cli.Context) error {
 			if !reflect.DeepEqual(ctx.StringSlice("serve"), []string{"10", "20"}) {
 				t.Errorf("main name not set")
 			}
 			if !reflect.DeepEqual(ctx.StringSlice("s"), []string{"10", "20"}) {
 				t.Errorf("short name not set")
 			}
+			return nil
 		},
 	}).Run([]string{"run", "-s", "10", "-s", "20"})
 }
@@ -129,13 +138,14 @@ func TestParseMultiInt(t *testing.T) {
 		Flags: []cli.Flag{
 			cli.IntFlag{Name: "serve, s"},
 		},
-		Action: func(ctx *cli.Context) {
+		Action: func(ctx *cli.Context) error {
 			if ctx.Int("serve") != 10 {
 				t.Errorf("main name not set")
 			}
 			if ctx.Int("s") != 10 {
 				t.Errorf("short name not set")
 			}
+			return nil
 		},
 	}
 	a.Run([]string{"run", "-s", "10"})
@@ -146,13 +156,14 @@ func TestParseMultiBool(t *testing.T) {
 		Flags: []cli.Flag{
 			cli.BoolFlag{Name: "serve, s"},
 		},
-		Action: func(ctx *cli.Context) {
+		Action: func(ctx *cli.Context) error {
 			if ctx.Bool("serve") != true {
 				t.Errorf("main name not set")
 			}
 			if ctx.Bool("s") != true {
 				t.Errorf("short name not set")
 			}
+			return nil
 		},
 	}
 	a.Run([]string{"run", "--serve"})
@@ -181,14 +192,1609 @@ func TestParseGeneric(t *testing.T) {
 		Flags: []cli.Flag{
 			cli.GenericFlag{Name: "serve, s", Value: &Parser{}},
 		},
-		Action: func(ctx *cli.Context) {
+		Action: func(ctx *cli.Context) error {
 			if !reflect.DeepEqual(ctx.Generic("serve"), &Parser{"10", "20"}) {
 				t.Errorf("main name not set")
 			}
 			if !reflect.DeepEqual(ctx.Generic("s"), &Parser{"10", "20"}) {
 				t.Errorf("short name not set")
 			}
+			return nil
 		},
 	}
 	a.Run([]string{"run", "-s", "10,20"})
 }
+
+func TestParseIP(t *testing.T) {
+	var bind, fallback net.IP
+	var cidr *net.IPNet
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewIPFlag("bind, b", nil, "address to bind to"),
+			cli.NewIPFlag("fallback", net.ParseIP("127.0.0.1"), "fallback address"),
+			cli.NewIPNetFlag("cidr", nil, "network to allow"),
+		},
+		Action: func(ctx *cli.Context) error {
+			bind = ctx.IP("bind")
+			fallback = ctx.IP("fallback")
+			cidr = ctx.IPNet("cidr")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-b", "10.0.0.1", "--cidr", "10.0.0.0/24"})
+	expect(t, err, nil)
+	expect(t, bind.String(), "10.0.0.1")
+	expect(t, fallback.String(), "127.0.0.1")
+	expect(t, cidr.String(), "10.0.0.0/24")
+}
+
+func TestParseIP_Malformed(t *testing.T) {
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewIPFlag("bind", nil, "address to bind to"),
+			cli.NewIPNetFlag("cidr", nil, "network to allow"),
+		},
+		Action: func(ctx *cli.Context) error {
+			t.Errorf("action run with malformed flags")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "--bind", "10.0.0.256"})
+	refute(t, err, nil)
+	err = a.Run([]string{"run", "--cidr", "10.0.0.1"})
+	refute(t, err, nil)
+}
+
+var urlFlagTests = []struct {
+	value string
+	valid bool
+}{
+	{"https://api.example.com", true},
+	{"http://localhost:8080/v1", true},
+	{"api.example.com", false},
+	{"/v1/users", false},
+	{"ftp://files.example.com", false},
+	{"https://exa mple.com", false},
+}
+
+func TestParseURL(t *testing.T) {
+	for _, test := range urlFlagTests {
+		var endpoint *url.URL
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.NewURLFlag("endpoint", "", "the API endpoint"),
+			},
+			Action: func(ctx *cli.Context) error {
+				endpoint = ctx.URL("endpoint")
+				return nil
+			},
+		}
+		err := a.Run([]string{"run", "--endpoint", test.value})
+		if test.valid {
+			expect(t, err, nil)
+			expect(t, endpoint.String(), test.value)
+		} else if err == nil {
+			t.Errorf("expected %q to be rejected", test.value)
+		}
+	}
+}
+
+func TestParseURL_Schemes(t *testing.T) {
+	var endpoint, fallback *url.URL
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewURLFlag("endpoint", "", "the file server", "ftp", "sftp"),
+			cli.NewURLFlag("fallback", "sftp://backup.example.com", "the backup server", "sftp"),
+		},
+		Action: func(ctx *cli.Context) error {
+			endpoint = ctx.URL("endpoint")
+			fallback = ctx.URL("fallback")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "--endpoint", "ftp://files.example.com"})
+	expect(t, err, nil)
+	expect(t, endpoint.Host, "files.example.com")
+	expect(t, fallback.String(), "sftp://backup.example.com")
+
+	err = a.Run([]string{"run", "--endpoint", "https://files.example.com"})
+	refute(t, err, nil)
+}
+
+func TestParseURL_HostlessSchemes(t *testing.T) {
+	var endpoint *url.URL
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewURLFlag("endpoint", "", "where to send reports", "file", "mailto"),
+		},
+		Action: func(ctx *cli.Context) error {
+			endpoint = ctx.URL("endpoint")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "--endpoint", "file:///etc/x"})
+	expect(t, err, nil)
+	expect(t, endpoint.Path, "/etc/x")
+
+	err = a.Run([]string{"run", "--endpoint", "mailto:a@b"})
+	expect(t, err, nil)
+	expect(t, endpoint.Opaque, "a@b")
+
+	err = a.Run([]string{"run", "--endpoint", "/etc/x"})
+	refute(t, err, nil)
+}
+
+func TestNewURLFlag_InvalidDefault(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("expected an invalid default URL to panic")
+		}
+	}()
+	cli.NewURLFlag("endpoint", "https://", "the API endpoint")
+}
+
+func TestUintSliceFlagHelpOutput(t *testing.T) {
+	flag := cli.NewUintSliceFlag("port, p", nil, "ports to open")
+	expect(t, flag.String(), "--port, -p '--port option --port option'\tports to open")
+}
+
+func TestParseMultiUintSlice(t *testing.T) {
+	var ports []uint
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewUintSliceFlag("port, p", nil, "ports to open"),
+		},
+		Action: func(ctx *cli.Context) error {
+			ports = ctx.UintSlice("port")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-p", "22", "-p", "80"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(ports, []uint{22, 80}) {
+		t.Errorf("%v does not match %v", ports, []uint{22, 80})
+	}
+}
+
+func TestParseUintSlice_ZeroValue(t *testing.T) {
+	var ports []uint
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.UintSliceFlag{Name: "port, p"},
+		},
+		Action: func(ctx *cli.Context) error {
+			ports = ctx.UintSlice("port")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-p", "22"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(ports, []uint{22}) {
+		t.Errorf("%v does not match %v", ports, []uint{22})
+	}
+}
+
+func TestParseUintSlice_Negative(t *testing.T) {
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewUintSliceFlag("port, p", nil, "ports to open"),
+		},
+		Action: func(ctx *cli.Context) error {
+			t.Errorf("action run with a negative port")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-p", "22", "-p", "-80"})
+	refute(t, err, nil)
+}
+
+func TestParseKeyValueSlice(t *testing.T) {
+	var headers []cli.KeyValue
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewKeyValueSliceFlag("header, H", nil, "headers to send"),
+		},
+		Action: func(ctx *cli.Context) error {
+			headers = ctx.KeyValueSlice("header")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-H", "Accept=text/plain", "-H", "X-Token=a=b", "-H", "Accept=application/json"})
+	expect(t, err, nil)
+
+	expected := []cli.KeyValue{
+		{Key: "Accept", Value: "text/plain"},
+		{Key: "X-Token", Value: "a=b"},
+		{Key: "Accept", Value: "application/json"},
+	}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("%v does not match %v", headers, expected)
+	}
+}
+
+func TestParseKeyValueSlice_ZeroValue(t *testing.T) {
+	var headers []cli.KeyValue
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.KeyValueSliceFlag{Name: "header, H"},
+		},
+		Action: func(ctx *cli.Context) error {
+			headers = ctx.KeyValueSlice("header")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-H", "Accept=text/plain"})
+	expect(t, err, nil)
+
+	expected := []cli.KeyValue{{Key: "Accept", Value: "text/plain"}}
+	if !reflect.DeepEqual(headers, expected) {
+		t.Errorf("%v does not match %v", headers, expected)
+	}
+}
+
+func TestParseKeyValueSlice_Malformed(t *testing.T) {
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewKeyValueSliceFlag("header, H", nil, "headers to send"),
+		},
+		Action: func(ctx *cli.Context) error {
+			t.Errorf("action run with a malformed header")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-H", "Accept"})
+	refute(t, err, nil)
+}
+
+func TestParseGenericBool(t *testing.T) {
+	var verbose bool
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.GenericFlag{Name: "verbose, V", Value: new(cli.Bool)},
+		},
+		Action: func(ctx *cli.Context) error {
+			verbose = ctx.Bool("verbose") && ctx.Bool("V")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "--verbose", "arg"})
+	expect(t, err, nil)
+	expect(t, verbose, true)
+
+	a.Flags[0] = cli.GenericFlag{Name: "verbose, V", Value: new(cli.Bool)}
+	err = a.Run([]string{"run", "--verbose=false"})
+	expect(t, err, nil)
+	expect(t, verbose, false)
+}
+
+var genericBoolTests = []struct {
+	args     []string
+	expected bool
+	first    string
+}{
+	{[]string{"run", "cmd", "-v"}, true, ""},
+	{[]string{"run", "cmd", "--verbose"}, true, ""},
+	{[]string{"run", "cmd", "--verbose=false"}, false, ""},
+	{[]string{"run", "cmd", "-v=false"}, false, ""},
+	{[]string{"run", "cmd", "--verbose", "true"}, true, "true"},
+	{[]string{"run", "cmd", "--verbose", "false"}, true, "false"},
+}
+
+func TestParseGenericBoolForms(t *testing.T) {
+	for _, test := range genericBoolTests {
+		var verbose, short bool
+		var first string
+		a := cli.App{
+			Commands: []cli.Command{
+				{
+					Name: "cmd",
+					Flags: []cli.Flag{
+						cli.GenericFlag{Name: "verbose, v", Value: new(cli.Bool)},
+					},
+					Action: func(ctx *cli.Context) error {
+						verbose = ctx.Bool("verbose")
+						short = ctx.Bool("v")
+						first = ctx.Args().First()
+						return nil
+					},
+				},
+			},
+		}
+		err := a.Run(test.args)
+		expect(t, err, nil)
+		expect(t, verbose, test.expected)
+		expect(t, short, test.expected)
+		expect(t, first, test.first)
+	}
+}
+
+func TestParseDerivedString(t *testing.T) {
+	var logFile string
+	var logFileSet bool
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "name", Value: "server"},
+			cli.DerivedStringFlag{
+				Name: "log-file, l",
+				DefaultFunc: func(ctx *cli.Context) string {
+					return ctx.String("name") + ".log"
+				},
+			},
+		},
+		Action: func(ctx *cli.Context) error {
+			logFile = ctx.String("l")
+			logFileSet = ctx.IsSet("log-file")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "--name", "worker"})
+	expect(t, err, nil)
+	expect(t, logFile, "worker.log")
+	expect(t, logFileSet, false)
+
+	err = a.Run([]string{"run", "--name", "worker", "-l", "custom.log"})
+	expect(t, err, nil)
+	expect(t, logFile, "custom.log")
+}
+
+func TestParseDerivedString_Wrapped(t *testing.T) {
+	var logFile string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "name", Value: "server"},
+			cli.OrderedFlag{Flag: cli.DerivedStringFlag{
+				Name: "log-file",
+				DefaultFunc: func(ctx *cli.Context) string {
+					return ctx.String("name") + ".log"
+				},
+			}},
+		},
+		Action: func(ctx *cli.Context) error {
+			logFile = ctx.String("log-file")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "--name", "worker"})
+	expect(t, err, nil)
+	expect(t, logFile, "worker.log")
+}
+
+func TestParseDerivedStringCommand(t *testing.T) {
+	var logFile string
+	a := cli.App{
+		Commands: []cli.Command{
+			{
+				Name: "cmd",
+				Flags: []cli.Flag{
+					cli.StringFlag{Name: "name", Value: "server"},
+					cli.DerivedStringFlag{
+						Name: "log-file",
+						DefaultFunc: func(ctx *cli.Context) string {
+							return ctx.String("name") + ".log"
+						},
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					logFile = ctx.String("log-file")
+					return nil
+				},
+			},
+		},
+	}
+
+	err := a.Run([]string{"run", "cmd"})
+	expect(t, err, nil)
+	expect(t, logFile, "server.log")
+}
+
+var flagNameTests = []struct {
+	name  string
+	valid bool
+}{
+	{"name", true},
+	{"name, n", true},
+	{"name,n", true},
+	{"dry-run", true},
+	{"-name", false},
+	{"--name", false},
+	{"name, -n", false},
+	{"", false},
+	{"name,", false},
+	{"first name", false},
+	{"name, n x", false},
+}
+
+func TestFlagNameValidation(t *testing.T) {
+	for _, test := range flagNameTests {
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: test.name},
+			},
+			Action: func(ctx *cli.Context) error { return nil },
+		}
+		err := a.Run([]string{"run"})
+		if test.valid && err != nil {
+			t.Errorf("%q rejected: %s", test.name, err)
+		}
+		if !test.valid && err == nil {
+			t.Errorf("%q accepted", test.name)
+		}
+	}
+}
+
+func TestCommandFlagNameValidation(t *testing.T) {
+	a := cli.App{
+		Commands: []cli.Command{
+			{
+				Name:   "cmd",
+				Flags:  []cli.Flag{cli.BoolFlag{Name: "-verbose"}},
+				Action: func(ctx *cli.Context) error { return nil },
+			},
+		},
+	}
+	err := a.Run([]string{"run", "cmd"})
+	expect(t, err.Error(), `Invalid flag name "-verbose": "-verbose" must not start with a dash`)
+}
+
+func TestParseEnvString(t *testing.T) {
+	t.Setenv("APP_REGION", "eu-west")
+
+	var region string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.EnvStringFlag{Name: "region", Value: "us-east", EnvVar: "APP_REGION"},
+		},
+		Action: func(ctx *cli.Context) error {
+			region = ctx.String("region")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run"})
+	expect(t, err, nil)
+	expect(t, region, "eu-west")
+
+	err = a.Run([]string{"run", "--region", "ap-south"})
+	expect(t, err, nil)
+	expect(t, region, "ap-south")
+}
+
+var envStringFlagTests = []struct {
+	flag     cli.EnvStringFlag
+	expected string
+}{
+	{cli.EnvStringFlag{Name: "token", Usage: "API token"}, "--token \tAPI token"},
+	{cli.EnvStringFlag{Name: "token", Usage: "API token", EnvVar: "APP_TOKEN"}, "--token \tAPI token [$APP_TOKEN]"},
+	{cli.EnvStringFlag{Name: "token, t", Usage: "API token", EnvVar: "APP_TOKEN, TOKEN"}, "--token, -t \tAPI token [$APP_TOKEN, $TOKEN]"},
+}
+
+func TestEnvStringFlagHelpOutput(t *testing.T) {
+	for _, test := range envStringFlagTests {
+		expect(t, test.flag.String(), test.expected)
+	}
+}
+
+func TestParseEnvStringMultipleEnvVars(t *testing.T) {
+	var token string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.EnvStringFlag{Name: "token", EnvVar: "APP_TOKEN, TOKEN"},
+		},
+		Action: func(ctx *cli.Context) error {
+			token = ctx.String("token")
+			return nil
+		},
+	}
+
+	t.Setenv("TOKEN", "fallback")
+	err := a.Run([]string{"run"})
+	expect(t, err, nil)
+	expect(t, token, "fallback")
+
+	t.Setenv("APP_TOKEN", "preferred")
+	err = a.Run([]string{"run"})
+	expect(t, err, nil)
+	expect(t, token, "preferred")
+}
+
+func TestParseEnvStringNoCommandLine(t *testing.T) {
+	t.Setenv("APP_API_KEY", "s3cr3t")
+
+	var key string
+	a := cli.App{
+		Commands: []cli.Command{
+			{
+				Name: "cmd",
+				Flags: []cli.Flag{
+					cli.EnvStringFlag{Name: "api-key", EnvVar: "APP_API_KEY", NoCommandLine: true},
+				},
+				Action: func(ctx *cli.Context) error {
+					key = ctx.String("api-key")
+					return nil
+				},
+			},
+		},
+	}
+
+	err := a.Run([]string{"run", "cmd"})
+	expect(t, err, nil)
+	expect(t, key, "s3cr3t")
+
+	err = a.Run([]string{"run", "cmd", "--api-key", "other"})
+	expect(t, err.Error(), "unknown flag: --api-key")
+}
+
+func ExampleEnvStringFlag() {
+	os.Setenv("GREET_API_KEY", "s3cr3t")
+	defer os.Unsetenv("GREET_API_KEY")
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Commands = []cli.Command{
+		{
+			Name:        "hello",
+			Usage:       "say hello",
+			Description: "greets someone by name",
+			Flags: []cli.Flag{
+				cli.EnvStringFlag{Name: "name", Value: "bob", Usage: "who to greet", EnvVar: "GREET_NAME"},
+				cli.EnvStringFlag{Name: "api-key", Usage: "the key to use", EnvVar: "GREET_API_KEY", NoCommandLine: true},
+			},
+			Action: func(c *cli.Context) error {
+				fmt.Println("Hello,", c.String("name"), "using", c.String("api-key"))
+				return nil
+			},
+		},
+	}
+	app.Run([]string{"greet", "hello"})
+	app.Run([]string{"greet", "help", "hello"})
+	// Output:
+	// Hello, bob using s3cr3t
+	// NAME:
+	//    hello - say hello
+	//
+	// USAGE:
+	//    greet hello [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    greets someone by name
+	//
+	// OPTIONS:
+	//    --name 'bob'  who to greet [$GREET_NAME]
+	//
+	// GLOBAL OPTIONS:
+	//    --version, -v  print the version
+	//    --help, -h     show help
+}
+
+type Password string
+
+func (p *Password) Set(value string) error {
+	if len(value) < 8 {
+		return fmt.Errorf("%q is too short", value)
+	}
+	*p = Password(value)
+	return nil
+}
+
+func (p *Password) String() string {
+	return string(*p)
+}
+
+func TestSecretFlagHelpOutput(t *testing.T) {
+	password := Password("hunter22")
+	flag := cli.GenericFlag{Name: "password", Value: &password, Secret: true}
+	expect(t, strings.Contains(flag.String(), "hunter22"), false)
+	expect(t, strings.Contains(flag.String(), "***"), true)
+
+	token := cli.EnvStringFlag{Name: "token", Value: "abc123", Secret: true}
+	expect(t, token.String(), "--token '***'\t")
+}
+
+func TestSecretFlagParseError(t *testing.T) {
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Commands: []cli.Command{
+			{
+				Name: "login",
+				Flags: []cli.Flag{
+					cli.GenericFlag{Name: "password, p", Value: new(Password), Secret: true},
+					cli.GenericFlag{Name: "hint", Value: new(Password)},
+				},
+				Action: func(ctx *cli.Context) error { return nil },
+			},
+		},
+	}
+
+	err := a.Run([]string{"run", "login", "-p", "hunter2"})
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "hunter2"), false)
+	expect(t, err.Error(), `invalid value "***" for flag -p: "***" is too short`)
+
+	err = a.Run([]string{"run", "login", "--hint", "kitty"})
+	expect(t, strings.Contains(err.Error(), "kitty"), true)
+}
+
+func TestSecretFlag(t *testing.T) {
+	token := cli.SecretFlag{Flag: cli.StringFlag{Name: "token, t", Value: "abc123", Usage: "the API token"}}
+	expect(t, token.String(), "--token, -t '***'\tthe API token")
+
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.OrderedFlag{Flag: cli.SecretFlag{Flag: cli.GenericFlag{Name: "password, p", Value: new(Password)}}},
+		},
+		Action: func(ctx *cli.Context) error { return nil },
+	}
+	err := a.Run([]string{"run", "-p", "hunter2"})
+	refute(t, err, nil)
+	expect(t, err.Error(), `invalid value "***" for flag -p: "***" is too short`)
+}
+
+func TestBoolNegationPrefix(t *testing.T) {
+	run := func(prefix string, args ...string) (bool, error) {
+		var cache bool
+		a := cli.NewApp()
+		a.Writer = ioutil.Discard
+		a.BoolNegationPrefix = prefix
+		a.Flags = []cli.Flag{
+			cli.BoolTFlag{Name: "cache, c"},
+		}
+		a.Action = func(ctx *cli.Context) error {
+			cache = ctx.Bool("cache") || ctx.Bool("c")
+			return nil
+		}
+		err := a.Run(append([]string{"run"}, args...))
+		return cache, err
+	}
+
+	cache, err := run("no-", "--no-cache")
+	expect(t, err, nil)
+	expect(t, cache, false)
+
+	cache, err = run("disable-", "--disable-cache")
+	expect(t, err, nil)
+	expect(t, cache, false)
+
+	cache, err = run("disable-", "--disable-cache=false")
+	expect(t, err, nil)
+	expect(t, cache, true)
+
+	_, err = run("disable-", "--no-cache")
+	refute(t, err, nil)
+
+	_, err = run("", "--no-cache")
+	refute(t, err, nil)
+}
+
+var boolTTests = []struct {
+	args     []string
+	expected bool
+}{
+	{[]string{}, true},
+	{[]string{"--no-color"}, false},
+	{[]string{"--no-color=false"}, true},
+	{[]string{"--color=false"}, false},
+	{[]string{"--no-color", "--color"}, true},
+}
+
+func TestBoolTFlag_Bool(t *testing.T) {
+	flags := map[string]cli.Flag{
+		"plain":      cli.BoolTFlag{Name: "color"},
+		"ordered":    cli.OrderedFlag{Flag: cli.BoolTFlag{Name: "color"}, DisplayOrder: 1},
+		"normalized": cli.NormalizedFlag{Flag: cli.BoolTFlag{Name: "color"}, Normalize: strings.ToLower},
+	}
+	for kind, f := range flags {
+		for _, test := range boolTTests {
+			var color, set bool
+			a := cli.NewApp()
+			a.Writer = ioutil.Discard
+			a.Commands = []cli.Command{
+				{
+					Name:  "show",
+					Flags: []cli.Flag{f},
+					Action: func(ctx *cli.Context) error {
+						color = ctx.Bool("color")
+						set = ctx.IsSet("color")
+						return nil
+					},
+				},
+			}
+			err := a.Run(append([]string{"run", "show"}, test.args...))
+			if err != nil || color != test.expected {
+				t.Errorf("%s flag with %v: got %v (%v), expected %v", kind, test.args, color, err, test.expected)
+			}
+			expect(t, set, len(test.args) > 0)
+		}
+	}
+}
+
+var byteSizeTests = []struct {
+	value    string
+	expected int64
+}{
+	{"1024", 1024},
+	{"1KB", 1000},
+	{"1KiB", 1024},
+	{"2.5MB", 2500000},
+	{"1.5GiB", 1610612736},
+	{"10 b", 10},
+}
+
+func TestParseByteSize(t *testing.T) {
+	for _, test := range byteSizeTests {
+		var size int64
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.NewByteSizeFlag("max-size", 0, "largest file to accept"),
+			},
+			Action: func(ctx *cli.Context) error {
+				size = ctx.ByteSize("max-size")
+				return nil
+			},
+		}
+		err := a.Run([]string{"run", "--max-size", test.value})
+		expect(t, err, nil)
+		if size != test.expected {
+			t.Errorf("%q parsed as %d, expected %d", test.value, size, test.expected)
+		}
+	}
+}
+
+func TestParseByteSize_Invalid(t *testing.T) {
+	for _, value := range []string{"1K", "1XB", "MB", "-1MB"} {
+		var size cli.ByteSize
+		err := size.Set(value)
+		if err == nil {
+			t.Errorf("%q parsed without an error", value)
+		}
+	}
+
+	var size cli.ByteSize
+	expect(t, size.Set("1M").Error(), `Ambiguous size unit "M" in "1M": use MB for powers of 1000 or MiB for powers of 1024`)
+}
+
+func TestByteSizeFlagHelpOutput(t *testing.T) {
+	flag := cli.NewByteSizeFlag("max-size", 512<<20, "largest file to accept")
+	expect(t, strings.HasPrefix(flag.String(), "--max-size 512MiB\t"), true)
+}
+
+var percentTests = []struct {
+	value    string
+	base100  bool
+	expected float64
+}{
+	{"85%", false, 0.85},
+	{"0.85", false, 0.85},
+	{"85%", true, 85},
+	{"85", true, 85},
+	{"0%", false, 0},
+}
+
+func TestParsePercent(t *testing.T) {
+	for _, test := range percentTests {
+		var threshold float64
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.GenericFlag{Name: "threshold", Value: &cli.Percent{Base100: test.base100}},
+			},
+			Action: func(ctx *cli.Context) error {
+				threshold = ctx.Percent("threshold")
+				return nil
+			},
+		}
+		err := a.Run([]string{"run", "--threshold", test.value})
+		expect(t, err, nil)
+		if math.Abs(threshold-test.expected) > 1e-9 {
+			t.Errorf("%q parsed as %v, expected %v", test.value, threshold, test.expected)
+		}
+	}
+}
+
+func TestParsePercent_OutOfRange(t *testing.T) {
+	for _, value := range []string{"150%", "85", "-5%", "abc"} {
+		var percent cli.Percent
+		if err := percent.Set(value); err == nil {
+			t.Errorf("%q parsed without an error", value)
+		}
+	}
+
+	percent := cli.Percent{Base100: true}
+	expect(t, percent.Set("150%").Error(), `Percentage "150%" is out of range: expected 0% to 100%`)
+	expect(t, percent.Set("150").Error(), `Percentage "150" is out of range: expected 0% to 100%`)
+}
+
+func TestPercentFlagHelpOutput(t *testing.T) {
+	flag := cli.NewPercentFlag("threshold", 0.85, "alert threshold")
+	expect(t, strings.HasPrefix(flag.String(), "--threshold 85%\t"), true)
+}
+
+var intervalPresets = map[string]time.Duration{
+	"hourly": time.Hour,
+	"daily":  24 * time.Hour,
+	"weekly": 7 * 24 * time.Hour,
+}
+
+func TestParsePresetDuration(t *testing.T) {
+	for value, expected := range map[string]time.Duration{"daily": 24 * time.Hour, "90m": 90 * time.Minute} {
+		var interval time.Duration
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.NewPresetDurationFlag("interval", intervalPresets, "how often to run"),
+			},
+			Action: func(ctx *cli.Context) error {
+				interval = ctx.Generic("interval").(*cli.PresetDuration).Value()
+				return nil
+			},
+		}
+		err := a.Run([]string{"run", "--interval", value})
+		expect(t, err, nil)
+		expect(t, interval, expected)
+	}
+
+	d := cli.PresetDuration{Presets: intervalPresets}
+	expect(t, d.Set("monthly").Error(), `Invalid duration "monthly": expected a duration such as 1h30m or one of daily, hourly, weekly`)
+	expect(t, d.Set("60m"), nil)
+	expect(t, d.String(), "hourly")
+}
+
+func TestParseEnumSlice(t *testing.T) {
+	var features []string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewEnumSliceFlag("features", []string{"auth", "cache", "metrics"}, "features to enable"),
+		},
+		Action: func(ctx *cli.Context) error {
+			features = ctx.EnumSlice("features")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "--features", "auth, metrics", "--features", "cache"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(features, []string{"auth", "metrics", "cache"}) {
+		t.Errorf("unexpected features %v", features)
+	}
+}
+
+func TestParseEnumSlice_OtherNames(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"--features", "auth,metrics"}, "auth,metrics"},
+		{[]string{"-f", "auth", "--features", "cache"}, "auth,cache"},
+	}
+	for _, test := range tests {
+		var features, short []string
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.NewEnumSliceFlag("features, f", []string{"auth", "cache", "metrics"}, "features to enable"),
+			},
+			Action: func(ctx *cli.Context) error {
+				features, short = ctx.EnumSlice("features"), ctx.EnumSlice("f")
+				return nil
+			},
+		}
+
+		err := a.Run(append([]string{"run"}, test.args...))
+		expect(t, err, nil)
+		expect(t, strings.Join(features, ","), test.expected)
+		expect(t, strings.Join(short, ","), test.expected)
+	}
+}
+
+func TestParseEnumSlice_Unknown(t *testing.T) {
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.NewEnumSliceFlag("features", []string{"auth", "cache", "metrics"}, "features to enable"),
+		},
+		Action: func(ctx *cli.Context) error { return nil },
+	}
+	err := a.Run([]string{"run", "--features", "auth,tracing"})
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), `Unknown value "tracing" in "auth,tracing": expected any of auth, cache, metrics`), true)
+}
+
+func TestParseThreeNameFlag(t *testing.T) {
+	for _, arg := range []string{"--output", "-o", "--out"} {
+		var output string
+		var set bool
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "output, o, out", Value: "text"},
+			},
+			Action: func(ctx *cli.Context) error {
+				for _, name := range []string{"output", "o", "out"} {
+					if ctx.String(name) != "json" {
+						t.Errorf("%s: %s is %q", arg, name, ctx.String(name))
+					}
+					if !ctx.IsSet(name) {
+						t.Errorf("%s: %s is not set", arg, name)
+					}
+				}
+				output = ctx.String("out")
+				set = ctx.IsSet("o")
+				return nil
+			},
+		}
+		err := a.Run([]string{"run", arg, "json"})
+		expect(t, err, nil)
+		expect(t, output, "json")
+		expect(t, set, true)
+	}
+}
+
+func TestParseThreeNameFlag_TwoForms(t *testing.T) {
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "output, o, out"},
+		},
+		Action: func(ctx *cli.Context) error { return nil },
+	}
+	err := a.Run([]string{"run", "--out", "json", "-o", "text"})
+	refute(t, err, nil)
+}
+
+func TestParsePath(t *testing.T) {
+	oldHomeDir := cli.HomeDir
+	defer func() {
+		cli.HomeDir = oldHomeDir
+	}()
+	cli.HomeDir = func() (string, error) {
+		return "/home/test", nil
+	}
+
+	var config, data string
+	var includes []string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewPathFlag("config, c", "~/.greet", "configuration file"),
+			cli.NewPathFlag("data", "", "data directory"),
+			cli.NewPathSliceFlag("include, I", nil, "directories to search"),
+		},
+		Action: func(ctx *cli.Context) error {
+			config = ctx.Path("config")
+			data = ctx.Path("data")
+			includes = ctx.PathSlice("I")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "--data", "~/share//greet/", "-I", "~", "-I", "lib/../include"})
+	expect(t, err, nil)
+	expect(t, config, "/home/test/.greet")
+	expect(t, data, "/home/test/share/greet")
+	if !reflect.DeepEqual(includes, []string{"/home/test", "include"}) {
+		t.Errorf("unexpected includes %v", includes)
+	}
+}
+
+func TestParsePathSlice_ZeroValue(t *testing.T) {
+	var includes []string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.PathSliceFlag{Name: "include, I"},
+		},
+		Action: func(ctx *cli.Context) error {
+			includes = ctx.PathSlice("include")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-I", "lib/../include"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(includes, []string{"include"}) {
+		t.Errorf("unexpected includes %v", includes)
+	}
+}
+
+var countFlagTests = []struct {
+	args     []string
+	expected int
+}{
+	{[]string{}, 0},
+	{[]string{"-v"}, 1},
+	{[]string{"-v", "-v"}, 2},
+	{[]string{"-vvv"}, 3},
+	{[]string{"-vv", "--verbose"}, 3},
+	{[]string{"-vfv", "file"}, 2},
+	{[]string{"--name", "-vv", "-v"}, 1},
+	{[]string{"--", "-vv"}, 0},
+}
+
+func TestParseCountFlag(t *testing.T) {
+	for _, test := range countFlagTests {
+		verbosity := -1
+		a := cli.App{
+			Commands: []cli.Command{
+				{
+					Name: "cmd",
+					Flags: []cli.Flag{
+						cli.CountFlag{Name: "verbose, v", Usage: "show more output"},
+						cli.BoolFlag{Name: "f"},
+						cli.StringFlag{Name: "name"},
+					},
+					Action: func(ctx *cli.Context) error {
+						verbosity = ctx.Count("v")
+						return nil
+					},
+				},
+			},
+		}
+		err := a.Run(append([]string{"run", "cmd"}, test.args...))
+		expect(t, err, nil)
+		if verbosity != test.expected {
+			t.Errorf("%v counted %d, expected %d", test.args, verbosity, test.expected)
+		}
+	}
+}
+
+func TestParseCountFlag_App(t *testing.T) {
+	var debug int
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.CountFlag{Name: "d"},
+			cli.BoolFlag{Name: "x"},
+		},
+		Action: func(ctx *cli.Context) error {
+			debug = ctx.Count("d")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-dxd", "file", "-dd"})
+	expect(t, err, nil)
+	expect(t, debug, 2)
+}
+
+func TestParseCountFlag_Command(t *testing.T) {
+	var verbosity int
+	var force bool
+	a := cli.App{
+		Commands: []cli.Command{
+			{
+				Name: "cmd",
+				Flags: []cli.Flag{
+					cli.CountFlag{Name: "v"},
+					cli.BoolFlag{Name: "f"},
+				},
+				Action: func(ctx *cli.Context) error {
+					verbosity = ctx.Count("v")
+					force = ctx.Bool("f")
+					return nil
+				},
+			},
+		},
+	}
+	err := a.Run([]string{"run", "cmd", "arg", "-vvf"})
+	expect(t, err, nil)
+	expect(t, verbosity, 2)
+	expect(t, force, true)
+}
+
+var shortValueFlagTests = []struct {
+	args   []string
+	output string
+	debug  int
+	rest   string
+}{
+	{[]string{"-o=json"}, "json", 0, ""},
+	{[]string{"-o", "json"}, "json", 0, ""},
+	{[]string{"-ojson"}, "json", 0, ""},
+	{[]string{"-o=a=b"}, "a=b", 0, ""},
+	{[]string{"-do=json", "file"}, "json", 1, "file"},
+	{[]string{"-ddojson", "file"}, "json", 2, "file"},
+	{[]string{"-do", "json", "file"}, "json", 1, "file"},
+	{[]string{"-d=true", "-o", "-d"}, "-d", 1, ""},
+}
+
+func TestParseShortValueFlags(t *testing.T) {
+	for _, test := range shortValueFlagTests {
+		var output, rest string
+		var debug int
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "output, o", Value: "text"},
+				cli.CountFlag{Name: "d"},
+			},
+			Action: func(ctx *cli.Context) error {
+				output = ctx.String("o")
+				debug = ctx.Count("d")
+				rest = strings.Join(ctx.Args(), " ")
+				return nil
+			},
+		}
+		err := a.Run(append([]string{"run"}, test.args...))
+		expect(t, err, nil)
+		if output != test.output || debug != test.debug || rest != test.rest {
+			t.Errorf("%v parsed -o %q, -d %d and args %q, expected %q, %d and %q", test.args, output, debug, rest, test.output, test.debug, test.rest)
+		}
+	}
+}
+
+func TestParseInt64UintFlags(t *testing.T) {
+	var size int64
+	var workers uint
+	var limit uint64
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.Int64Flag{Name: "size, s"},
+			cli.UintFlag{Name: "workers", Value: 4},
+			cli.Uint64Flag{Name: "limit"},
+		},
+		Action: func(ctx *cli.Context) error {
+			size = ctx.Int64("size")
+			workers = ctx.Uint("workers")
+			limit = ctx.Uint64("limit")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-s", "-4294967296", "--limit", "18446744073709551615"})
+	expect(t, err, nil)
+	expect(t, size, int64(-4294967296))
+	expect(t, workers, uint(4))
+	expect(t, limit, uint64(18446744073709551615))
+
+	err = a.Run([]string{"run", "--workers", "-1"})
+	refute(t, err, nil)
+}
+
+func TestParseDurationFlag(t *testing.T) {
+	var timeout, interval time.Duration
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.DurationFlag{Name: "timeout, t", Value: 30 * time.Second, NonNegative: true},
+			cli.DurationFlag{Name: "offset"},
+		},
+		Action: func(ctx *cli.Context) error {
+			timeout = ctx.Duration("timeout")
+			interval = ctx.Duration("offset")
+			return nil
+		},
+	}
+	err := a.Run([]string{"run"})
+	expect(t, err, nil)
+	expect(t, timeout, 30*time.Second)
+	expect(t, interval, time.Duration(0))
+
+	err = a.Run([]string{"run", "-t", "1m30s", "--offset", "-5s"})
+	expect(t, err, nil)
+	expect(t, timeout, 90*time.Second)
+	expect(t, interval, -5*time.Second)
+
+	err = a.Run([]string{"run", "--timeout", "-1s"})
+	refute(t, err, nil)
+	expect(t, strings.Contains(err.Error(), "must not be negative"), true)
+}
+
+func TestParseStringSliceFromLines(t *testing.T) {
+	file, err := ioutil.TempFile("", "hosts")
+	expect(t, err, nil)
+	defer os.Remove(file.Name())
+	file.WriteString("# web servers\nweb1\n  web2  \n\n   # db servers\ndb1\n")
+	file.Close()
+
+	var hosts []string
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "hosts-file", Value: &cli.StringSlice{}, FromLines: true},
+		},
+		Action: func(ctx *cli.Context) error {
+			hosts = ctx.StringSlice("hosts-file")
+			return nil
+		},
+	}
+
+	err = a.Run([]string{"run", "--hosts-file", file.Name()})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(hosts, []string{"web1", "web2", "db1"}) {
+		t.Errorf("unexpected hosts %q", hosts)
+	}
+
+	err = a.Run([]string{"run", "--hosts-file", file.Name() + ".missing"})
+	refute(t, err, nil)
+}
+
+func TestParseTimestampFlag(t *testing.T) {
+	var since, until time.Time
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.TimestampFlag{Name: "since", Layouts: []string{time.RFC3339, "2006-01-02 15:04", "2006-01-02"}},
+			cli.TimestampFlag{Name: "until"},
+		},
+		Action: func(ctx *cli.Context) error {
+			since = ctx.Timestamp("since")
+			until = ctx.Timestamp("until")
+			return nil
+		},
+	}
+
+	tests := []struct {
+		value    string
+		expected time.Time
+	}{
+		{"2015-03-14T09:26:53Z", time.Date(2015, 3, 14, 9, 26, 53, 0, time.UTC)},
+		{"2015-03-14 09:26", time.Date(2015, 3, 14, 9, 26, 0, 0, time.UTC)},
+		{"2015-03-14", time.Date(2015, 3, 14, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		err := a.Run([]string{"run", "--since", test.value})
+		expect(t, err, nil)
+		if !since.Equal(test.expected) {
+			t.Errorf("%q parsed as %v, expected %v", test.value, since, test.expected)
+		}
+		expect(t, until.IsZero(), true)
+	}
+
+	err := a.Run([]string{"run", "--since", "03/14/2015"})
+	refute(t, err, nil)
+	err = a.Run([]string{"run", "--until", "2015-03-14"})
+	refute(t, err, nil)
+}
+
+func TestParseTimestampFlag_OtherNames(t *testing.T) {
+	for _, arg := range []string{"--since", "-s"} {
+		var since, short time.Time
+		a := cli.App{
+			Flags: []cli.Flag{
+				cli.TimestampFlag{Name: "since, s", Layouts: []string{"2006-01-02", time.RFC3339}},
+			},
+			Action: func(ctx *cli.Context) error {
+				since, short = ctx.Timestamp("since"), ctx.Timestamp("s")
+				return nil
+			},
+		}
+
+		err := a.Run([]string{"run", arg, "2015-03-14T09:26:53Z"})
+		expect(t, err, nil)
+		expected := time.Date(2015, 3, 14, 9, 26, 53, 0, time.UTC)
+		if !since.Equal(expected) || !short.Equal(expected) {
+			t.Errorf("%s parsed as %v and %v, expected %v", arg, since, short, expected)
+		}
+	}
+}
+
+func TestParseSliceMaxItems(t *testing.T) {
+	var files []string
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "file, f", Value: &cli.StringSlice{}, MaxItems: 2},
+		},
+		Action: func(ctx *cli.Context) error {
+			files = ctx.StringSlice("f")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "-f", "a", "-f", "b"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(files, []string{"a", "b"}) {
+		t.Errorf("unexpected files %v", files)
+	}
+
+	a.Flags = []cli.Flag{
+		cli.StringSliceFlag{Name: "file, f", Value: &cli.StringSlice{}, MaxItems: 2},
+	}
+	err = a.Run([]string{"run", "--file", "a", "--file", "b", "--file", "c"})
+	expect(t, err.Error(), `invalid value "c" for flag -file: too many --file values (max 2)`)
+}
+
+func TestParseIntSliceMaxItems(t *testing.T) {
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.IntSliceFlag{Name: "port", Value: &cli.IntSlice{}, MaxItems: 1},
+		},
+		Action: func(ctx *cli.Context) error { return nil },
+	}
+	err := a.Run([]string{"run", "--port", "80", "--port", "443"})
+	expect(t, err.Error(), `invalid value "443" for flag -port: too many --port values (max 1)`)
+}
+
+func TestParseSliceReplaceDefaults(t *testing.T) {
+	var regions []string
+	var ports []int
+	defaults := &cli.StringSlice{"us-east", "us-west"}
+	a := cli.App{
+		Writer: ioutil.Discard,
+		Flags: []cli.Flag{
+			cli.StringSliceFlag{Name: "region, r", Value: defaults, ReplaceDefaults: true, MaxItems: 2},
+			cli.IntSliceFlag{Name: "port", Value: &cli.IntSlice{80}, ReplaceDefaults: true},
+		},
+		Action: func(ctx *cli.Context) error {
+			regions = ctx.StringSlice("region")
+			ports = ctx.IntSlice("port")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "-r", "eu-west", "--region", "ap-south", "--port", "8080"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(regions, []string{"eu-west", "ap-south"}) {
+		t.Errorf("unexpected regions %v", regions)
+	}
+	if !reflect.DeepEqual(ports, []int{8080}) {
+		t.Errorf("unexpected ports %v", ports)
+	}
+
+	err = a.Run([]string{"run"})
+	expect(t, err, nil)
+	if !reflect.DeepEqual(regions, []string{"us-east", "us-west"}) {
+		t.Errorf("unexpected regions %v", regions)
+	}
+	if !reflect.DeepEqual(ports, []int{80}) {
+		t.Errorf("unexpected ports %v", ports)
+	}
+	expect(t, len(*defaults), 2)
+}
+
+func TestStringMapKeepsInsertionOrder(t *testing.T) {
+	m := cli.NewStringMap(map[string]string{"zone": "b", "app": "web"})
+	for _, pair := range []string{"tier=1", "env=prod", "app=api", "build=7"} {
+		expect(t, m.Set(pair), nil)
+	}
+	refute(t, m.Set("novalue"), nil)
+
+	expect(t, strings.Join(m.Keys(), " "), "app zone tier env build")
+	expect(t, m.String(), "[app=api zone=b tier=1 env=prod build=7]")
+	expect(t, m.Value()["app"], "api")
+	expect(t, len(m.Value()), 5)
+}
+
+func TestParseStringMap(t *testing.T) {
+	var keys []string
+	var labels map[string]string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NewStringMapFlag("label, l", nil, "labels to apply"),
+		},
+		Action: func(ctx *cli.Context) error {
+			m := ctx.Generic("label").(*cli.StringMap)
+			keys, labels = m.Keys(), m.Value()
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-l", "team=core", "-l", "app=web", "-l", "team=ops"})
+	expect(t, err, nil)
+	expect(t, strings.Join(keys, " "), "team app")
+	expect(t, labels["team"], "ops")
+}
+
+func TestParseStringMap_ZeroValue(t *testing.T) {
+	var labels map[string]string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.StringMapFlag{Name: "label, l"},
+		},
+		Action: func(ctx *cli.Context) error {
+			labels = ctx.Generic("label").(*cli.StringMap).Value()
+			return nil
+		},
+	}
+	err := a.Run([]string{"run", "-l", "team=core"})
+	expect(t, err, nil)
+	expect(t, labels["team"], "core")
+}
+
+func TestParseEnvPrefix(t *testing.T) {
+	t.Setenv("APP_LOG_LEVEL", "debug")
+	t.Setenv("APP_TAG", "a")
+	t.Setenv("APP_REGION", "ignored")
+	t.Setenv("REGION", "eu-west")
+
+	var level, region string
+	var tags []string
+	var levelSet bool
+	a := cli.App{
+		EnvPrefix: "APP",
+		Flags: []cli.Flag{
+			cli.StringFlag{Name: "log-level, l", Value: "info"},
+			cli.StringSliceFlag{Name: "tag, t", Value: &cli.StringSlice{}},
+			cli.EnvStringFlag{Name: "region", Value: "us-east", EnvVar: "REGION"},
+		},
+		Action: func(ctx *cli.Context) error {
+			level = ctx.String("l")
+			levelSet = ctx.IsSet("log-level")
+			tags = ctx.StringSlice("tag")
+			region = ctx.String("region")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run"})
+	expect(t, err, nil)
+	expect(t, level, "debug")
+	expect(t, levelSet, false)
+	expect(t, strings.Join(tags, ","), "a")
+	expect(t, region, "eu-west")
+
+	a.Flags[1] = cli.StringSliceFlag{Name: "tag, t", Value: &cli.StringSlice{}}
+	err = a.Run([]string{"run", "--log-level", "warn", "-t", "b"})
+	expect(t, err, nil)
+	expect(t, level, "warn")
+	expect(t, strings.Join(tags, ","), "b")
+}
+
+var flagSpecTests = []struct {
+	spec     string
+	expected cli.Flag
+}{
+	{"string:name, n=world:who to greet", cli.StringFlag{Name: "name, n", Value: "world", Usage: "who to greet"}},
+	{"int:port=8080:the listen port", cli.IntFlag{Name: "port", Value: 8080, Usage: "the listen port"}},
+	{"int:mode=0o644:file mode", cli.IntFlag{Name: "mode", Value: 0644, Usage: "file mode"}},
+	{"int:mask=0xff", cli.IntFlag{Name: "mask", Value: 255}},
+	{"string:addr=localhost:8080:the address", cli.StringFlag{Name: "addr", Value: "localhost:8080", Usage: "the address"}},
+	{"string:endpoint=https://example.com:8443/v1:the API", cli.StringFlag{Name: "endpoint", Value: "https://example.com:8443/v1", Usage: "the API"}},
+	{"string:at=10:30", cli.StringFlag{Name: "at", Value: "10:30"}},
+	{"int64:offset=-5", cli.Int64Flag{Name: "offset", Value: -5}},
+	{"uint:workers=4:worker count", cli.UintFlag{Name: "workers", Value: 4, Usage: "worker count"}},
+	{"uint64:limit", cli.Uint64Flag{Name: "limit"}},
+	{"float64:ratio=0.5:a ratio: from 0 to 1", cli.Float64Flag{Name: "ratio", Value: 0.5, Usage: "a ratio: from 0 to 1"}},
+	{"bool:verbose:more output", cli.BoolFlag{Name: "verbose", Usage: "more output"}},
+	{"bool:cache=true", cli.BoolTFlag{Name: "cache"}},
+	{"count:v", cli.CountFlag{Name: "v"}},
+}
+
+func TestParseFlagSpec(t *testing.T) {
+	for _, test := range flagSpecTests {
+		f, err := cli.ParseFlagSpec(test.spec)
+		expect(t, err, nil)
+		expect(t, f, test.expected)
+	}
+
+	f, err := cli.ParseFlagSpec("string-slice:tag=a,b:tags")
+	expect(t, err, nil)
+	if !reflect.DeepEqual(f, cli.StringSliceFlag{Name: "tag", Value: &cli.StringSlice{"a", "b"}, Usage: "tags"}) {
+		t.Errorf("unexpected flag %#v", f)
+	}
+	f, err = cli.ParseFlagSpec("int-slice:port=80, 443")
+	expect(t, err, nil)
+	if !reflect.DeepEqual(f, cli.IntSliceFlag{Name: "port", Value: &cli.IntSlice{80, 443}}) {
+		t.Errorf("unexpected flag %#v", f)
+	}
+}
+
+func TestParseFlagSpecErrors(t *testing.T) {
+	for spec, message := range map[string]string{
+		"port":             `Invalid flag spec "port": expected type:name=default:usage`,
+		"duration:timeout": `Invalid flag spec "duration:timeout": unknown flag type "duration"`,
+		"int:=8080":        `Invalid flag spec "int:=8080": missing flag name`,
+		"int:port=many":    `Invalid flag spec "int:port=many": invalid default "many"`,
+		"count:v=3":        `Invalid flag spec "count:v=3": a count flag cannot have a default`,
+	} {
+		_, err := cli.ParseFlagSpec(spec)
+		if err == nil || err.Error() != message {
+			t.Errorf("ParseFlagSpec(%q) returned %v, expected %s", spec, err, message)
+		}
+	}
+}
+
+func TestParseAliasFlag(t *testing.T) {
+	var directory, short string
+	var set, force bool
+	var out bytes.Buffer
+	a := cli.App{
+		Writer: &out,
+		Flags: []cli.Flag{
+			cli.AliasFlag{Name: "dir", AliasOf: "directory"},
+			cli.StringFlag{Name: "directory, d", Value: "."},
+			cli.BoolFlag{Name: "force"},
+			cli.AliasFlag{Name: "overwrite", AliasOf: "force"},
+		},
+		Action: func(ctx *cli.Context) error {
+			directory, short = ctx.String("directory"), ctx.String("d")
+			set, force = ctx.IsSet("directory"), ctx.Bool("force")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "--dir", "x", "--overwrite"})
+	expect(t, err, nil)
+	expect(t, directory, "x")
+	expect(t, short, "x")
+	expect(t, set, true)
+	expect(t, force, true)
+
+	err = a.Run([]string{"run", "--help"})
+	expect(t, err, nil)
+	expect(t, strings.Contains(out.String(), "--directory"), true)
+	expect(t, strings.Contains(out.String(), "--dir "), false)
+	expect(t, strings.Contains(out.String(), "--overwrite"), false)
+}
+
+func TestParseNormalizedFlag(t *testing.T) {
+	var region, short string
+	var tags []string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NormalizedFlag{Flag: cli.StringFlag{Name: "region, r"}, Normalize: strings.ToUpper},
+			cli.NormalizedFlag{Flag: cli.StringSliceFlag{Name: "tag", Value: &cli.StringSlice{}}, Normalize: strings.TrimSpace},
+		},
+		Action: func(ctx *cli.Context) error {
+			region, short = ctx.String("region"), ctx.String("r")
+			tags = ctx.StringSlice("tag")
+			return nil
+		},
+	}
+
+	err := a.Run([]string{"run", "--region", "eu-west", "--tag", " a ", "--tag", "b "})
+	expect(t, err, nil)
+	expect(t, region, "EU-WEST")
+	expect(t, short, "EU-WEST")
+	if !reflect.DeepEqual(tags, []string{"a", "b"}) {
+		t.Errorf("unexpected tags %q", tags)
+	}
+}
+
+func TestParseNormalizedFlag_OtherNames(t *testing.T) {
+	var region, short string
+	a := cli.App{
+		Flags: []cli.Flag{
+			cli.NormalizedFlag{Flag: cli.StringFlag{Name: "region, r"}, Normalize: func(value string) string { return "x" + value }},
+		},
+		Action: func(ctx *cli.Context) error {
+			region, short = ctx.String("region"), ctx.String("r")
+			return nil
+		},
+	}
+
+	for _, name := range []string{"--region", "-r"} {
+		err := a.Run([]string{"run", name, "eu"})
+		expect(t, err, nil)
+		expect(t, region, "xeu")
+		expect(t, short, "xeu")
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	flags := []cli.Flag{
+		cli.StringFlag{Name: "name, n", Value: "bob"},
+		cli.IntFlag{Name: "count", Value: 1},
+		cli.Float64Flag{Name: "ratio"},
+		cli.BoolTFlag{Name: "color"},
+		cli.StringSliceFlag{Name: "tag", Value: &cli.StringSlice{}},
+		cli.CountFlag{Name: "v"},
+	}
+
+	ctx, err := cli.ParseFlags("tool", flags, []string{"-n", "alice", "--count", "3", "--ratio", "0.5", "--no-color", "--tag", "a", "--tag", "b", "-vv", "file", "--", "-x"})
+	expect(t, err, nil)
+	expect(t, ctx.String("name"), "alice")
+	expect(t, ctx.Int("count"), 3)
+	expect(t, ctx.Float64("ratio"), 0.5)
+	expect(t, ctx.BoolT("color"), false)
+	expect(t, strings.Join(ctx.StringSlice("tag"), ","), "a,b")
+	expect(t, ctx.Count("v"), 2)
+	expect(t, strings.Join(ctx.Args(), " "), "file")
+	expect(t, strings.Join(ctx.PassthroughArgs(), " "), "-x")
+
+	_, err = cli.ParseFlags("tool", flags, []string{"--count", "many"})
+	if _, ok := err.(*cli.ParseError); !ok {
+		t.Errorf("expected a ParseError, got %v", err)
+	}
+}
+
+func TestApp_ParseFlags(t *testing.T) {
+	app := cli.NewApp()
+	app.Name = "tool"
+	app.BoolNegationPrefix = "disable-"
+	app.Flags = []cli.Flag{cli.BoolTFlag{Name: "cache"}}
+
+	ctx, err := app.ParseFlags([]string{"--disable-cache", "file"})
+	expect(t, err, nil)
+	expect(t, ctx.BoolT("cache"), false)
+	expect(t, ctx.Args().First(), "file")
+
+	_, err = app.ParseFlags([]string{"--no-cache"})
+	refute(t, err, nil)
+
+	app.BoolNegationPrefix = ""
+	_, err = app.ParseFlags([]string{"--disable-cache"})
+	refute(t, err, nil)
+}
@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A unit of size, by its suffix
+type sizeUnit struct {
+	suffix string
+	bytes  int64
+}
+
+// The size units from largest to smallest, each SI unit after the IEC unit
+// of the same order
+var sizeUnits = []sizeUnit{
+	{"EiB", 1 << 60}, {"EB", 1e18},
+	{"PiB", 1 << 50}, {"PB", 1e15},
+	{"TiB", 1 << 40}, {"TB", 1e12},
+	{"GiB", 1 << 30}, {"GB", 1e9},
+	{"MiB", 1 << 20}, {"MB", 1e6},
+	{"KiB", 1 << 10}, {"KB", 1e3},
+	{"B", 1},
+}
+
+// ByteSize is a Generic flag value holding a number of bytes. Sizes are given
+// as a number with an optional SI (KB, MB, ...) or IEC (KiB, MiB, ...)
+// suffix, such as 512MB or 1.5GiB.
+type ByteSize int64
+
+func (b *ByteSize) Set(value string) error {
+	size, err := parseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = ByteSize(size)
+	return nil
+}
+
+// Formats the size with the largest unit that divides it exactly
+func (b *ByteSize) String() string {
+	size := int64(*b)
+	if size == 0 {
+		return "0"
+	}
+	for _, unit := range sizeUnits {
+		if size%unit.bytes == 0 {
+			return strconv.FormatInt(size/unit.bytes, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+func (b *ByteSize) Value() int64 {
+	return int64(*b)
+}
+
+// Creates a GenericFlag for a size in bytes, such as 1024, 1KB or 2.5MiB
+func NewByteSizeFlag(name string, value int64, usage string) GenericFlag {
+	size := ByteSize(value)
+	return GenericFlag{Name: name, Value: &size, Usage: usage}
+}
+
+func parseByteSize(value string) (int64, error) {
+	s := strings.TrimSpace(value)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	number, suffix := s, ""
+	if i >= 0 {
+		number, suffix = s[:i], strings.TrimSpace(s[i:])
+	}
+
+	n, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid size %q: expected a number with an optional unit such as KB or MiB", value)
+	}
+
+	multiplier := int64(1)
+	if suffix != "" {
+		multiplier = 0
+		for _, unit := range sizeUnits {
+			if strings.EqualFold(suffix, unit.suffix) {
+				multiplier = unit.bytes
+				break
+			}
+		}
+		if multiplier == 0 {
+			switch strings.ToUpper(suffix) {
+			case "K", "M", "G", "T", "P", "E":
+				return 0, fmt.Errorf("Ambiguous size unit %q in %q: use %sB for powers of 1000 or %siB for powers of 1024", suffix, value, strings.ToUpper(suffix), strings.ToUpper(suffix))
+			}
+			return 0, fmt.Errorf("Unknown size unit %q in %q", suffix, value)
+		}
+	}
+
+	size := n * float64(multiplier)
+	if size >= math.MaxInt64 {
+		return 0, fmt.Errorf("Size %q is too large", value)
+	}
+	return int64(math.Round(size)), nil
+}
+
+// Percent is a Generic flag value holding a percentage. Values with a trailing
+// %, such as 85%, are always read as percentages. Bare values, and Value, are
+// fractions between 0 and 1, or between 0 and 100 when Base100 is set.
+type Percent struct {
+	// Whether bare values and Value are out of 100 rather than 1
+	Base100 bool
+	// The percentage as a fraction between 0 and 1
+	fraction float64
+}
+
+func (p *Percent) Set(value string) error {
+	s := strings.TrimSpace(value)
+	percent := strings.HasSuffix(s, "%")
+	n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(s, "%")), 64)
+	if err != nil {
+		return fmt.Errorf("Invalid percentage %q", value)
+	}
+
+	fraction := n
+	if percent || p.Base100 {
+		fraction = n / 100
+	}
+	if fraction < 0 || fraction > 1 || math.IsNaN(fraction) {
+		if percent || p.Base100 {
+			return fmt.Errorf("Percentage %q is out of range: expected 0%% to 100%%", value)
+		}
+		return fmt.Errorf("Percentage %q is out of range: expected 0 to 1, or a value such as 85%%", value)
+	}
+	p.fraction = fraction
+	return nil
+}
+
+func (p *Percent) String() string {
+	return strconv.FormatFloat(p.fraction*100, 'f', -1, 64) + "%"
+}
+
+// Returns the percentage as a fraction between 0 and 1, or between 0 and 100
+// when Base100 is set
+func (p *Percent) Value() float64 {
+	if p.Base100 {
+		return p.fraction * 100
+	}
+	return p.fraction
+}
+
+// Creates a GenericFlag for a percentage whose value is a fraction between 0
+// and 1. It accepts values such as 85% or 0.85.
+func NewPercentFlag(name string, value float64, usage string) GenericFlag {
+	return GenericFlag{Name: name, Value: &Percent{fraction: value}, Usage: usage}
+}
+
+// PresetDuration is a Generic flag value holding a duration, given either as
+// the name of one of its presets, such as daily, or as a duration such as 90m.
+type PresetDuration struct {
+	// The durations by name
+	Presets  map[string]time.Duration
+	duration time.Duration
+}
+
+func (d *PresetDuration) Set(value string) error {
+	s := strings.TrimSpace(value)
+	if preset, ok := d.Presets[s]; ok {
+		d.duration = preset
+		return nil
+	}
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("Invalid duration %q: expected a duration such as 1h30m or one of %s", value, strings.Join(d.names(), ", "))
+	}
+	d.duration = duration
+	return nil
+}
+
+// Formats the duration as the name of the first preset, in alphabetical
+// order, that is equal to it, or else as a duration
+func (d *PresetDuration) String() string {
+	for _, name := range d.names() {
+		if d.Presets[name] == d.duration {
+			return name
+		}
+	}
+	return d.duration.String()
+}
+
+func (d *PresetDuration) Value() time.Duration {
+	return d.duration
+}
+
+func (d *PresetDuration) names() []string {
+	names := make([]string, 0, len(d.Presets))
+	for name := range d.Presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Creates a GenericFlag for a duration given as one of the named presets or
+// as a duration, such as --interval daily or --interval 90m
+func NewPresetDurationFlag(name string, presets map[string]time.Duration, usage string) GenericFlag {
+	return GenericFlag{Name: name, Value: &PresetDuration{Presets: presets}, Usage: usage}
+}
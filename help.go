@@ -1,8 +1,15 @@
 package cli
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 	"text/template"
 )
@@ -14,17 +21,17 @@ var AppHelpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 
 USAGE:
-   {{.Name}} [global options] command [command options] [arguments...]
+   {{if .UsageText}}{{.UsageText}}{{else}}{{.Name}} [global options] command [command options] [arguments...]{{end}}
 
 VERSION:
    {{.Version}}
 
 COMMANDS:
-   {{range .Commands}}{{.Name}}{{with .ShortName}}, {{.}}{{end}}{{ "\t" }}{{.Usage}}
-   {{end}}
+{{range commandLines .Commands}}   {{.}}
+{{end}}
 GLOBAL OPTIONS:
-   {{range .Flags}}{{.}}
-   {{end}}
+{{range flagLines .Flags}}   {{.}}
+{{end}}
 `
 
 // The text template for the command help topic.
@@ -34,16 +41,28 @@ var CommandHelpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 
 USAGE:
-   command {{.Name}} [command options] [arguments...]
+   {{if .UsageText}}{{.UsageText}}{{else}}{{.Path}} [command options] {{if .ArgsUsage}}{{.ArgsUsage}}{{else}}[arguments...]{{end}}{{end}}
 
 DESCRIPTION:
    {{.Description}}
 
 OPTIONS:
-   {{range .Flags}}{{.}}
-   {{end}}
+{{range flagLines .Flags}}   {{.}}
+{{end}}{{if .GlobalFlags}}
+GLOBAL OPTIONS:
+{{range flagLines .GlobalFlags}}   {{.}}
+{{end}}{{end}}
 `
 
+// The data the command help template is rendered with: the command along
+// with its full path, such as "git remote add", and the global flags it
+// inherits
+type commandHelp struct {
+	Command
+	Path        string
+	GlobalFlags []Flag
+}
+
 // The text template for the subcommand help topic.
 // cli.go uses text/template to render templates. You can
 // render custom help text by setting this variable.
@@ -51,66 +70,87 @@ var SubcommandHelpTemplate = `NAME:
    {{.Name}} - {{.Usage}}
 
 USAGE:
-   {{.Name}} [global options] command [command options] [arguments...]
+   {{if .UsageText}}{{.UsageText}}{{else}}{{.Name}} [global options] command [command options] [arguments...]{{end}}
 
 COMMANDS:
-   {{range .Commands}}{{.Name}}{{with .ShortName}}, {{.}}{{end}}{{ "\t" }}{{.Usage}}
-   {{end}}
+{{range commandLines .Commands}}   {{.}}
+{{end}}
 OPTIONS:
-   {{range .Flags}}{{.}}
-   {{end}}
+{{range flagLines .Flags}}   {{.}}
+{{end}}
 `
 
 var helpCommand = Command{
-	Name:      "help",
-	ShortName: "h",
-	Usage:     "Shows a list of commands or help for one command",
-	Action: func(c *Context) {
+	Name:    "help",
+	Aliases: []string{"h"},
+	Usage:   "Shows a list of commands or help for one command",
+	Action: func(c *Context) error {
 		args := c.Args()
 		if args.Present() {
 			ShowCommandHelp(c, args.First())
 		} else {
 			ShowAppHelp(c)
 		}
+		return nil
 	},
 }
 
 var helpSubcommand = Command{
-	Name:      "help",
-	ShortName: "h",
-	Usage:     "Shows a list of commands or help for one command",
-	Action: func(c *Context) {
+	Name:    "help",
+	Aliases: []string{"h"},
+	Usage:   "Shows a list of commands or help for one command",
+	Action: func(c *Context) error {
 		args := c.Args()
 		if args.Present() {
 			ShowCommandHelp(c, args.First())
 		} else {
 			ShowSubcommandHelp(c)
 		}
+		return nil
 	},
 }
 
-// Prints help for the App
+// Prints help for the App. The default printer writes the help to the
+// App's Writer, through the pager with App.UsePager.
 var HelpPrinter = printHelp
 
+// The App whose help is being shown, which the default HelpPrinter writes
+// to. Nil outside of showHelp, when it writes to os.Stdout.
+var helpApp *App
+
+// The width, in columns, that flag usage text is wrapped to in help output.
+// When zero the width is taken from the COLUMNS environment variable,
+// falling back to 80 columns.
+var HelpWidth = 0
+
+// The functions available to the help templates.
+var helpFuncs = template.FuncMap{
+	"commandLines": commandLines,
+	"flagLines":    flagLines,
+	"join":         strings.Join,
+}
+
 func ShowAppHelp(c *Context) {
-	HelpPrinter(AppHelpTemplate, c.App)
+	showHelp(c, AppHelpTemplate, c.App)
 }
 
 // Prints the list of subcommands as the default app completion method
 func DefaultAppComplete(c *Context) {
 	for _, command := range c.App.Commands {
-		fmt.Println(command.Name)
-		if command.ShortName != "" {
-			fmt.Println(command.ShortName)
+		if command.Hidden {
+			continue
+		}
+		for _, name := range command.Names() {
+			fmt.Fprintln(c.App.writer(), name)
 		}
 	}
 }
 
 // Prints help for the given command
 func ShowCommandHelp(c *Context, command string) {
-	for _, c := range c.App.Commands {
-		if c.HasName(command) {
-			HelpPrinter(CommandHelpTemplate, c)
+	for _, cmd := range c.App.Commands {
+		if cmd.HasName(command) {
+			showHelp(c, CommandHelpTemplate, commandHelp{cmd, cmd.path(c), globalFlags(c)})
 			return
 		}
 	}
@@ -118,18 +158,57 @@ func ShowCommandHelp(c *Context, command string) {
 	if c.App.CommandNotFound != nil {
 		c.App.CommandNotFound(c, command)
 	} else {
-		fmt.Printf("No help topic for '%v'\n", command)
+		fmt.Fprintf(c.App.writer(), NoHelpTopicText+"\n", command)
 	}
 }
 
+// Prints the usage line of the given command and how to get its full help,
+// for when the full help is too much
+func ShowCommandSynopsis(c *Context, command string) {
+	for _, cmd := range c.App.Commands {
+		if cmd.HasName(command) {
+			showSynopsis(c, commandSynopsis(c.App, cmd), cmd.path(c))
+			return
+		}
+	}
+
+	if c.App.CommandNotFound != nil {
+		c.App.CommandNotFound(c, command)
+	} else {
+		fmt.Fprintf(c.App.writer(), NoHelpTopicText+"\n", command)
+	}
+}
+
+// Returns the flags of the Apps in the lineage of c, which the commands of
+// c.App inherit, leaving out the bash completion flag
+func globalFlags(c *Context) []Flag {
+	var flags []Flag
+	seen := make(map[string]bool)
+	var app *App
+	for _, ctx := range c.lineage() {
+		if ctx.App == nil || ctx.App == app {
+			continue
+		}
+		app = ctx.App
+		for _, f := range app.Flags {
+			if f.getName() == BashCompletionFlag.Name || seen[f.getName()] {
+				continue
+			}
+			seen[f.getName()] = true
+			flags = append(flags, f)
+		}
+	}
+	return flags
+}
+
 // Prints help for the given subcommand
 func ShowSubcommandHelp(c *Context) {
-	HelpPrinter(SubcommandHelpTemplate, c.App)
+	showHelp(c, SubcommandHelpTemplate, c.App)
 }
 
 // Prints the version number of the App
 func ShowVersion(c *Context) {
-	fmt.Printf("%v version %v\n", c.App.Name, c.App.Version)
+	fmt.Fprintf(c.App.writer(), "%v version %v\n", c.App.Name, c.App.Version)
 }
 
 // Prints the lists of commands within a given context
@@ -143,14 +222,111 @@ func ShowCompletions(c *Context) {
 // Prints the custom completions for a given command
 func ShowCommandCompletions(ctx *Context, command string) {
 	c := ctx.App.Command(command)
-	if c != nil && c.BashComplete != nil {
+	if c == nil {
+		return
+	}
+	if c.BashComplete != nil {
 		c.BashComplete(ctx)
 	}
+	if c.ArgsComplete != nil {
+		c.ArgsComplete(ctx)
+	}
+}
+
+// Prints the usage error err followed by the synopsis line and a hint to run
+// name with --help, in place of the full help
+func showCompactUsage(c *Context, err error, synopsis, name string) {
+	fmt.Fprintf(c.App.writer(), "%s: %v\n", IncorrectUsageText, err)
+	showSynopsis(c, synopsis, name)
+}
+
+// Prints the synopsis of the command called name and a pointer to its help
+func showSynopsis(c *Context, synopsis, name string) {
+	fmt.Fprintf(c.App.writer(), UsageLineText+"\n", synopsis)
+	fmt.Fprintf(c.App.writer(), MoreInformationText+"\n", name)
+}
+
+// Returns the one-line synopsis of the App
+func appSynopsis(a *App) string {
+	if a.UsageText != "" {
+		return a.UsageText
+	}
+	return a.Name + " [global options] command [command options] [arguments...]"
+}
+
+// Returns the one-line synopsis of the command c of the App
+func commandSynopsis(a *App, c Command) string {
+	if c.UsageText != "" {
+		return c.UsageText
+	}
+	args := c.ArgsUsage
+	if args == "" {
+		args = "[arguments...]"
+	}
+	return fmt.Sprintf("%s %s [command options] %s", a.Name, c.Name, args)
+}
+
+// Prints help for the App of c with HelpPrinter
+func showHelp(c *Context, templ string, data interface{}) {
+	helpApp = c.App
+	defer func() {
+		helpApp = nil
+	}()
+	HelpPrinter(templ, data)
 }
 
 func printHelp(templ string, data interface{}) {
-	w := tabwriter.NewWriter(os.Stdout, 0, 8, 1, '\t', 0)
-	t := template.Must(template.New("help").Parse(templ))
+	a := helpApp
+	if a == nil {
+		printHelpTo(os.Stdout, templ, data)
+		return
+	}
+	if pager := a.pager(); pager != "" {
+		var out bytes.Buffer
+		printHelpTo(&out, templ, data)
+		page(pager, out.Bytes(), a.writer(), a.errWriter())
+		return
+	}
+	printHelpTo(a.writer(), templ, data)
+}
+
+// Reports whether w writes to a terminal, which App.UsePager pages help on.
+// Override it to page elsewhere.
+var WritesToTerminal = func(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// Returns the pager help is shown through: $PAGER when the App has UsePager
+// set and writes to a terminal, or "" otherwise
+func (a *App) pager() string {
+	if !a.UsePager || !WritesToTerminal(a.writer()) {
+		return ""
+	}
+	return os.Getenv("PAGER")
+}
+
+// Writes text to out through the pager command, or straight to out when the
+// pager cannot be started. The pager reports its errors to errOut.
+func page(pager string, text []byte, out, errOut io.Writer) {
+	cmd := exec.Command("sh", "-c", pager)
+	cmd.Stdin = bytes.NewReader(text)
+	cmd.Stdout = out
+	cmd.Stderr = errOut
+	if err := cmd.Start(); err != nil {
+		out.Write(text)
+		return
+	}
+	cmd.Wait()
+}
+
+func printHelpTo(out io.Writer, templ string, data interface{}) {
+	w := tabwriter.NewWriter(out, 0, 8, 1, '\t', 0)
+	t := template.Must(template.New("help").Funcs(helpFuncs).Parse(templ))
 	err := t.Execute(w, data)
 	if err != nil {
 		panic(err)
@@ -158,6 +334,167 @@ func printHelp(templ string, data interface{}) {
 	w.Flush()
 }
 
+// The indentation applied to every option line by the help templates
+const helpIndent = "   "
+
+// The spacing between the flag name and usage columns
+const helpGutter = "  "
+
+// The narrowest column usage text will be wrapped to
+const minUsageWidth = 20
+
+func helpWidth() int {
+	if HelpWidth > 0 {
+		return HelpWidth
+	}
+	if cols, err := strconv.Atoi(os.Getenv("COLUMNS")); err == nil && cols > 0 {
+		return cols
+	}
+	return 80
+}
+
+// Lays out the visible commands in two columns, listing each command with
+// all of its names
+func commandLines(commands []Command) []string {
+	var names, usages []string
+	for _, c := range commands {
+		if c.Hidden {
+			continue
+		}
+		names = append(names, strings.Join(c.Names(), ", "))
+		usages = append(usages, c.Usage)
+	}
+	return columns(names, usages)
+}
+
+// Lays out the flags that can be given on the command line in two columns,
+// splitting each flag's help on its first tab
+func flagLines(flags []Flag) []string {
+	var names, usages []string
+	for _, f := range orderFlags(flags) {
+		if !onCommandLine(f) || hiddenFlag(f) {
+			continue
+		}
+		parts := strings.SplitN(f.String(), "\t", 2)
+		names = append(names, parts[0])
+		if len(parts) > 1 {
+			usages = append(usages, flagUsage(f, parts[1]))
+		} else {
+			usages = append(usages, "")
+		}
+	}
+	return columns(names, usages)
+}
+
+// Returns the flags in the order help lists them: the OrderedFlags by their
+// DisplayOrder, then the others in the order they were registered
+func orderFlags(flags []Flag) []Flag {
+	ordered := append([]Flag(nil), flags...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, aOrdered := displayOrder(ordered[i])
+		b, bOrdered := displayOrder(ordered[j])
+		if aOrdered != bOrdered {
+			return aOrdered
+		}
+		return aOrdered && a < b
+	})
+	return ordered
+}
+
+// Returns the DisplayOrder of the OrderedFlag f is or wraps, if any
+func displayOrder(f Flag) (int, bool) {
+	ordered, ok := findFlag(f, func(f Flag) bool {
+		_, ok := f.(OrderedFlag)
+		return ok
+	}).(OrderedFlag)
+	return ordered.DisplayOrder, ok
+}
+
+// Fills in the {{.Default}} and {{.EnvVar}} placeholders of the usage text of
+// a flag with its default value and its environment variables, such as
+// $APP_PORT. The [$APP_PORT] hint that follows the usage text is left out
+// when the text places the variables itself. Usage text without placeholders
+// is returned as it is.
+func flagUsage(f Flag, usage string) string {
+	if !strings.Contains(usage, "{{") {
+		return usage
+	}
+
+	var data struct {
+		Default string
+		EnvVar  string
+	}
+	if envVars := flagEnvVars(f); envVars != "" {
+		hint := envHint(envVars)
+		data.EnvVar = strings.TrimSuffix(strings.TrimPrefix(hint, " ["), "]")
+		if strings.Contains(usage, ".EnvVar") {
+			usage = strings.TrimSuffix(usage, hint)
+		}
+	}
+
+	set := flag.NewFlagSet("", flag.ContinueOnError)
+	f.Apply(set)
+	names := strings.Split(f.getName(), ",")
+	if ff := set.Lookup(strings.TrimSpace(names[0])); ff != nil {
+		data.Default = ff.DefValue
+		if isSecret(f) {
+			data.Default = redact(data.Default)
+		}
+	}
+
+	t, err := template.New("usage").Parse(usage)
+	if err != nil {
+		return usage
+	}
+	var out bytes.Buffer
+	if err := t.Execute(&out, data); err != nil {
+		return usage
+	}
+	return out.String()
+}
+
+// Pads every name to the widest one and wraps the usage text beside it to
+// the remaining help width.
+func columns(names, usages []string) []string {
+	nameWidth := 0
+	for _, name := range names {
+		if len(name) > nameWidth {
+			nameWidth = len(name)
+		}
+	}
+
+	usageWidth := helpWidth() - len(helpIndent) - nameWidth - len(helpGutter)
+	if usageWidth < minUsageWidth {
+		usageWidth = minUsageWidth
+	}
+	continuation := "\n" + helpIndent + strings.Repeat(" ", nameWidth+len(helpGutter))
+
+	lines := make([]string, len(names))
+	for i := range names {
+		line := fmt.Sprintf("%-*s%s%s", nameWidth, names[i], helpGutter, strings.Join(wrapText(usages[i], usageWidth), continuation))
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return lines
+}
+
+// Splits text into lines no longer than width, breaking on whitespace.
+// Words longer than width are kept whole on their own line.
+func wrapText(text string, width int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		if line != "" && len(line)+1+len(word) > width {
+			lines = append(lines, line)
+			line = ""
+		}
+		if line != "" {
+			line += " "
+		}
+		line += word
+	}
+	return append(lines, line)
+}
+
 func checkVersion(c *Context) bool {
 	if c.GlobalBool("version") {
 		ShowVersion(c)
@@ -0,0 +1,285 @@
+package cli_test
+
+import (
+	"bytes"
+	"github.com/zenoss/cli"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func ExampleHelpWidth() {
+	// set args for examples sake
+	os.Args = []string{"greet", "h", "describeit"}
+
+	cli.HelpWidth = 60
+	defer func() {
+		cli.HelpWidth = 0
+	}()
+
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Commands = []cli.Command{
+		{
+			Name:        "describeit",
+			ShortName:   "d",
+			Usage:       "use it to see a description",
+			Description: "This is how we describe describeit the function",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "q", Usage: "be quiet"},
+				cli.StringFlag{Name: "name, n", Value: "bob", Usage: "a name to say"},
+				cli.IntFlag{Name: "repeat", Value: 1, Usage: "the number of times the greeting should be repeated before exiting"},
+			},
+			Action: func(c *cli.Context) error { return nil },
+		},
+	}
+	app.Run(os.Args)
+	// Output:
+	// NAME:
+	//    describeit - use it to see a description
+	//
+	// USAGE:
+	//    greet describeit [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    This is how we describe describeit the function
+	//
+	// OPTIONS:
+	//    -q                be quiet
+	//    --name, -n 'bob'  a name to say
+	//    --repeat '1'      the number of times the greeting should
+	//                      be repeated before exiting
+	//
+	// GLOBAL OPTIONS:
+	//    --version, -v  print the version
+	//    --help, -h     show help
+}
+
+func ExampleCommand_Aliases() {
+	// set args for examples sake
+	os.Args = []string{"git", "remote", "help"}
+
+	app := cli.NewApp()
+	app.Name = "git"
+	app.Commands = []cli.Command{
+		{
+			Name:  "remote",
+			Usage: "manage remotes",
+			Subcommands: []cli.Command{
+				{
+					Name:      "remove",
+					ShortName: "rm",
+					Aliases:   []string{"delete"},
+					Usage:     "remove a remote",
+				}, {
+					Name:  "add",
+					Usage: "add a remote",
+				}, {
+					Name:   "prune",
+					Usage:  "prune stale branches",
+					Hidden: true,
+				},
+			},
+		},
+	}
+	app.Run(os.Args)
+	// Output:
+	// NAME:
+	//    git remote - manage remotes
+	//
+	// USAGE:
+	//    git remote [global options] command [command options] [arguments...]
+	//
+	// VERSION:
+	//    0.0.0
+	//
+	// COMMANDS:
+	//    remove, rm, delete  remove a remote
+	//    add                 add a remote
+	//    help, h             Shows a list of commands or help for one command
+	//
+	// GLOBAL OPTIONS:
+	//    --help, -h  show help
+}
+
+func ExampleShowCommandHelp_globalFlags() {
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "config", Value: "greet.yml", Usage: "configuration file"},
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:        "hello",
+			Usage:       "say hello",
+			Description: "greets someone by name",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "name, n", Value: "bob", Usage: "who to greet"},
+			},
+			Action: func(c *cli.Context) error { return nil },
+		},
+	}
+	app.Run([]string{"greet", "help", "hello"})
+	// Output:
+	// NAME:
+	//    hello - say hello
+	//
+	// USAGE:
+	//    greet hello [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    greets someone by name
+	//
+	// OPTIONS:
+	//    --name, -n 'bob'  who to greet
+	//
+	// GLOBAL OPTIONS:
+	//    --config 'greet.yml'  configuration file
+	//    --version, -v         print the version
+	//    --help, -h            show help
+}
+
+func ExampleOrderedFlag() {
+	app := cli.NewApp()
+	app.Name = "deploy"
+	app.Commands = []cli.Command{
+		{
+			Name:        "push",
+			Usage:       "push a release",
+			Description: "pushes the current release to an environment",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "dry-run", Usage: "only show what would change"},
+				cli.OrderedFlag{Flag: cli.StringFlag{Name: "region", Value: "us", Usage: "where to deploy"}, DisplayOrder: 2},
+				cli.IntFlag{Name: "retries", Value: 3, Usage: "how often to retry"},
+				cli.NormalizedFlag{
+					Flag:      cli.OrderedFlag{Flag: cli.StringFlag{Name: "env, e", Value: "staging", Usage: "the environment"}, DisplayOrder: 1},
+					Normalize: strings.ToLower,
+				},
+				cli.OrderedFlag{Flag: cli.BoolFlag{Name: "force", Usage: "push even if checks fail"}, DisplayOrder: 2},
+			},
+			Action: func(c *cli.Context) error { return nil },
+		},
+	}
+	app.Run([]string{"deploy", "help", "push"})
+	// Output:
+	// NAME:
+	//    push - push a release
+	//
+	// USAGE:
+	//    deploy push [command options] [arguments...]
+	//
+	// DESCRIPTION:
+	//    pushes the current release to an environment
+	//
+	// OPTIONS:
+	//    --env, -e 'staging'  the environment
+	//    --region 'us'        where to deploy
+	//    --force              push even if checks fail
+	//    --dry-run            only show what would change
+	//    --retries '3'        how often to retry
+	//
+	// GLOBAL OPTIONS:
+	//    --version, -v  print the version
+	//    --help, -h     show help
+}
+
+func TestShowAppHelp_Pager(t *testing.T) {
+	oldPager := os.Getenv("PAGER")
+	defer os.Setenv("PAGER", oldPager)
+	os.Setenv("PAGER", "echo paged")
+
+	for _, usePager := range []bool{false, true} {
+		var out bytes.Buffer
+		app := cli.NewApp()
+		app.Name = "greet"
+		app.UsePager = usePager
+		app.Writer = &out
+
+		err := app.Run([]string{"greet", "--help"})
+		expect(t, err, nil)
+		if !strings.HasPrefix(out.String(), "NAME:\n   greet - ") {
+			t.Errorf("expected the help written to the Writer, got %q", out.String())
+		}
+	}
+}
+
+func TestShowAppHelp_PagerOnTerminal(t *testing.T) {
+	defer func(writesToTerminal func(io.Writer) bool) { cli.WritesToTerminal = writesToTerminal }(cli.WritesToTerminal)
+	cli.WritesToTerminal = func(w io.Writer) bool { return true }
+	t.Setenv("PAGER", "sed 's/^/> /'; echo paged >&2")
+
+	var out, errOut bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.UsePager = true
+	app.Writer = &out
+	app.ErrWriter = &errOut
+
+	err := app.Run([]string{"greet", "--help"})
+	expect(t, err, nil)
+	if !strings.HasPrefix(out.String(), "> NAME:\n>    greet - ") {
+		t.Errorf("expected the help written through the pager, got %q", out.String())
+	}
+	expect(t, errOut.String(), "paged\n")
+}
+
+func TestShowCommandSynopsis(t *testing.T) {
+	show := func(f func(*cli.Context, string)) string {
+		var out bytes.Buffer
+		app := cli.NewApp()
+		app.Name = "greet"
+		app.Writer = &out
+		app.Commands = []cli.Command{
+			{
+				Name:      "describeit",
+				Usage:     "use it to see a description",
+				ArgsUsage: "[name]",
+				Flags:     []cli.Flag{cli.BoolFlag{"loud", "describe it loudly"}},
+			},
+		}
+		app.Action = func(c *cli.Context) error {
+			f(c, "describeit")
+			return nil
+		}
+		err := app.Run([]string{"greet"})
+		expect(t, err, nil)
+		return out.String()
+	}
+
+	synopsis := show(cli.ShowCommandSynopsis)
+	expect(t, synopsis, "Usage: greet describeit [command options] [name]\nRun 'greet describeit --help' for more information.\n")
+
+	full := show(cli.ShowCommandHelp)
+	expect(t, strings.Contains(full, "describeit - use it to see a description"), true)
+	expect(t, strings.Contains(full, "--loud"), true)
+	expect(t, strings.Contains(synopsis, "--loud"), false)
+	expect(t, len(synopsis) < len(full), true)
+}
+
+func TestFlagUsagePlaceholders(t *testing.T) {
+	os.Unsetenv("GREET_NAME")
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "greet"
+	app.Writer = &out
+	app.Flags = []cli.Flag{
+		cli.IntFlag{Name: "port", Value: 8080, Usage: "the port (default {{.Default}})"},
+		cli.EnvStringFlag{Name: "name", Value: "bob", Usage: "who to greet, read from {{.EnvVar}}", EnvVar: "GREET_NAME"},
+		cli.StringFlag{Name: "greeting", Value: "hello", Usage: "what to say {{ if you like"},
+		cli.BoolFlag{Name: "loud", Usage: "shout it"},
+	}
+
+	err := app.Run([]string{"greet", "--help"})
+	expect(t, err, nil)
+	for _, usage := range []string{
+		"the port (default 8080)\n",
+		"who to greet, read from $GREET_NAME\n",
+		"what to say {{ if you like\n",
+		"shout it\n",
+	} {
+		if !strings.Contains(out.String(), usage) {
+			t.Errorf("expected %q in the help, got %q", usage, out.String())
+		}
+	}
+}
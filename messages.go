@@ -0,0 +1,77 @@
+package cli
+
+// The messages shown to users, in English by default. Apps can set them to
+// translations before running; the layout of help is translated through
+// AppHelpTemplate, CommandHelpTemplate and SubcommandHelpTemplate instead.
+// Messages with verbs are fmt format strings, and a translation must keep
+// their verbs in the same order.
+var (
+	// Printed before the help when the command line is wrong, followed by
+	// the error when there is one
+	IncorrectUsageText = "Incorrect Usage"
+	// The synopsis line of the compact usage shown by CompactUsageOnError
+	UsageLineText = "Usage: %s"
+	// The hint of the compact usage, given the full name of the command
+	MoreInformationText = "Run '%s --help' for more information."
+	// Printed when help is asked for a command that does not exist
+	NoHelpTopicText = "No help topic for '%v'"
+	// The error of Context.RequireOneOf for a single flag
+	RequiredFlagText = "%s is required"
+	// The error of Context.RequireOneOf for several flags, given all but the
+	// last joined by commas, then the last
+	RequiredOneOfText = "One of %s or %s is required"
+	// The error of a command with NoArgs given arguments
+	UnexpectedArgumentsText = "unexpected arguments: %s"
+	// The error for a flag that is not defined
+	UnknownFlagText = "unknown flag: %s"
+	// Follows UnknownFlagText in parentheses when a flag is named alike
+	DidYouMeanText = "did you mean %s?"
+	// The error when a slice flag is given more often than its MaxItems,
+	// given the name of the flag and the most
+	TooManyValuesText = "too many %s values (max %d)"
+	// The error when two names of a flag that do not share a value are both
+	// given
+	TwoFormsText = "Cannot use two forms of the same flag: %s %s"
+	// The error of a command that runs longer than its Timeout, given the
+	// full name of the command and the timeout
+	TimedOutText = "%s timed out after %v"
+	// The warning for a command that sets ShortName, given its name
+	ShortNameDeprecatedText = "Warning: command %q uses the deprecated ShortName, use Aliases instead"
+
+	// The hint Context.Confirm appends to its question
+	ConfirmHintText = "[y/N]"
+	// Printed by Context.Confirm after an answer it does not understand
+	ConfirmAgainText = "Please answer yes or no."
+	// The error of Context.Confirm and Context.PromptString when standard
+	// input is not a terminal, given the question
+	ConfirmNoTerminalText = "Cannot ask %q: standard input is not a terminal"
+	// The error of Context.Confirm after too many answers it does not
+	// understand, given the question
+	ConfirmNoAnswerText = "No valid answer to %q"
+
+	// The error for a config file of an unknown format, given its path
+	ConfigUnsupportedText = "Unsupported config file %s: expected a .json, .yaml, .yml or .toml file"
+	// The error for a config file that does not parse, given its path and
+	// the error
+	ConfigReadText = "Cannot read config file %s: %v"
+	// The error for a config value a flag does not accept, given the key and
+	// the error
+	ConfigValueText = "invalid value for %q in config: %v"
+
+	// The error for a shell completion scripts cannot be made for
+	UnsupportedShellText = "Unsupported shell: %s"
+	// The error of the completion install command when $SHELL names none of
+	// CompletionShells, given the shells
+	UndetectedShellText = "Cannot detect shell from $SHELL, use one of: %s"
+	// The error of the completion flag when $SHELL names none of
+	// CompletionShells, given $SHELL and the shells
+	UnsupportedShellEnvText = "Cannot print completion script for $SHELL %q: expected one of %s"
+	// Printed once a completion script is installed, given the shell, the
+	// program and the path of the script
+	CompletionInstalledText = "Installed %s completion for %s to %s"
+	// Printed after CompletionInstalledText for each shell, given the path of
+	// the bash script or the directory of the zsh and fish ones
+	BashCompletionHintText = "Source it from your ~/.bashrc to enable completion:\n   source %s"
+	ZshCompletionHintText  = "Add its directory to your fpath in ~/.zshrc to enable completion:\n   fpath=(%s $fpath)"
+	FishCompletionHintText = "It will be loaded automatically by new fish sessions (%s)."
+)
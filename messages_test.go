@@ -0,0 +1,45 @@
+package cli_test
+
+import (
+	"bytes"
+	"flag"
+	"github.com/zenoss/cli"
+	"strings"
+	"testing"
+)
+
+func TestMessages_Translated(t *testing.T) {
+	defer func(usage, unknown, moreInformation string) {
+		cli.IncorrectUsageText, cli.UnknownFlagText, cli.MoreInformationText = usage, unknown, moreInformation
+	}(cli.IncorrectUsageText, cli.UnknownFlagText, cli.MoreInformationText)
+	cli.IncorrectUsageText = "Uso incorrecto"
+	cli.UnknownFlagText = "opción desconocida: %s"
+	cli.MoreInformationText = "Ejecute '%s --help' para más información."
+
+	var out bytes.Buffer
+	app := cli.NewApp()
+	app.Name = "saludar"
+	app.Writer = &out
+	app.CompactUsageOnError = true
+	app.Commands = []cli.Command{
+		{Name: "hola", Action: func(c *cli.Context) error { return nil }},
+	}
+
+	err := app.Run([]string{"saludar", "hola", "--ruido"})
+	refute(t, err, nil)
+	expect(t, strings.Contains(out.String(), "Uso incorrecto: opción desconocida: --ruido\n"), true)
+	expect(t, strings.Contains(out.String(), "Ejecute 'saludar hola --help' para más información.\n"), true)
+}
+
+func TestMessages_TranslatedRequired(t *testing.T) {
+	defer func(required string) {
+		cli.RequiredFlagText = required
+	}(cli.RequiredFlagText)
+	cli.RequiredFlagText = "%s es obligatorio"
+
+	set := flag.NewFlagSet("test", 0)
+	set.String("file", "", "doc")
+	c := cli.NewContext(nil, set, set)
+	set.Parse([]string{})
+	expect(t, c.RequireOneOf("file").Error(), "--file es obligatorio")
+}
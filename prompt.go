@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// How many times Confirm asks again after an answer it does not understand
+const confirmAttempts = 3
+
+// Asks the yes or no question prompt, defaulting to no, and reads the answer
+// from the App's Reader. Answers are y, yes, n or no in any case, anything
+// else is asked again a few times. When the --yes flag was given the answer
+// is yes without asking. When the answer would be read from a standard input
+// that is not a terminal an error is returned instead.
+func (c *Context) Confirm(prompt string) (bool, error) {
+	if c.AssumeYes() {
+		return true, nil
+	}
+
+	in := c.App.reader()
+	if !isTerminal(in) {
+		return false, fmt.Errorf(ConfirmNoTerminalText, prompt)
+	}
+
+	for attempt := 0; attempt < confirmAttempts; attempt++ {
+		fmt.Fprintf(c.App.writer(), "%s %s ", prompt, ConfirmHintText)
+		answer, err := readLine(in)
+		if err == io.EOF && answer == "" {
+			return false, nil
+		}
+		if err != nil && err != io.EOF {
+			return false, err
+		}
+
+		switch strings.ToLower(strings.TrimSpace(answer)) {
+		case "y", "yes":
+			return true, nil
+		case "", "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(c.App.writer(), ConfirmAgainText)
+	}
+	return false, fmt.Errorf(ConfirmNoAnswerText, prompt)
+}
+
+// Returns the value of the string flag name, asking for it with prompt when
+// it was not given, such as for a required flag. An empty answer keeps the
+// default of the flag, which is shown in brackets. When the --yes flag was
+// given the default is taken without asking, and an error is returned if
+// there is none. When the answer would be read from a standard input that is
+// not a terminal an error is returned instead.
+func (c *Context) PromptString(name, prompt string) (string, error) {
+	value := c.String(name)
+	if c.IsSet(name) {
+		return value, nil
+	}
+	if c.AssumeYes() {
+		if value == "" {
+			return "", fmt.Errorf(RequiredFlagText, prefixFor(name)+name)
+		}
+		return value, nil
+	}
+
+	in := c.App.reader()
+	if !isTerminal(in) {
+		return "", fmt.Errorf(ConfirmNoTerminalText, prompt)
+	}
+	if value != "" {
+		fmt.Fprintf(c.App.writer(), "%s [%s]: ", prompt, value)
+	} else {
+		fmt.Fprintf(c.App.writer(), "%s: ", prompt)
+	}
+	answer, err := readLine(in)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		if value == "" {
+			return "", fmt.Errorf(RequiredFlagText, prefixFor(name)+name)
+		}
+		return value, nil
+	}
+	return answer, nil
+}
+
+// Reads up to the end of the line one byte at a time, so that nothing after
+// it is consumed from r
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n > 0 {
+			if b[0] == '\n' {
+				return string(line), nil
+			}
+			line = append(line, b[0])
+		}
+		if err != nil {
+			return string(line), err
+		}
+	}
+}
+
+// Reports whether r is interactive: any reader other than os.Stdin is taken
+// to be, os.Stdin only when it is a terminal
+func isTerminal(r io.Reader) bool {
+	f, ok := r.(*os.File)
+	if !ok || f != os.Stdin {
+		return true
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
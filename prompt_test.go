@@ -0,0 +1,131 @@
+package cli_test
+
+import (
+	"bytes"
+	"github.com/codegangsta/cli"
+	"strings"
+	"testing"
+)
+
+var confirmTests = []struct {
+	input    string
+	expected bool
+	prompts  int
+	err      bool
+}{
+	{"y\n", true, 1, false},
+	{"YES\n", true, 1, false},
+	{"n\n", false, 1, false},
+	{"No\n", false, 1, false},
+	{"\n", false, 1, false},
+	{"", false, 1, false},
+	{"sure\nyes\n", true, 2, false},
+	{"what\nmaybe\nnope\n", false, 3, true},
+}
+
+func TestContext_Confirm(t *testing.T) {
+	for _, test := range confirmTests {
+		var out bytes.Buffer
+		var confirmed bool
+		var err error
+
+		app := cli.NewApp()
+		app.Reader = strings.NewReader(test.input)
+		app.Writer = &out
+		app.Action = func(c *cli.Context) error {
+			confirmed, err = c.Confirm("Delete everything?")
+			return nil
+		}
+		app.Run([]string{"run"})
+
+		if confirmed != test.expected {
+			t.Errorf("%q confirmed %v, expected %v", test.input, confirmed, test.expected)
+		}
+		if (err != nil) != test.err {
+			t.Errorf("%q returned error %v", test.input, err)
+		}
+		expect(t, strings.Count(out.String(), "Delete everything? [y/N] "), test.prompts)
+	}
+}
+
+func TestContext_ConfirmAssumeYes(t *testing.T) {
+	var out bytes.Buffer
+	var confirmed bool
+
+	app := cli.NewApp()
+	app.EnableAssumeYes = true
+	app.Reader = strings.NewReader("n\n")
+	app.Writer = &out
+	app.Action = func(c *cli.Context) error {
+		confirmed, _ = c.Confirm("Delete everything?")
+		return nil
+	}
+	app.Run([]string{"run", "--yes"})
+
+	expect(t, confirmed, true)
+	expect(t, out.String(), "")
+}
+
+func TestContext_PromptString(t *testing.T) {
+	run := func(input string, args ...string) (string, string, error) {
+		var out bytes.Buffer
+		var env string
+		var err error
+
+		app := cli.NewApp()
+		app.EnableAssumeYes = true
+		app.Reader = strings.NewReader(input)
+		app.Writer = &out
+		app.Flags = []cli.Flag{
+			cli.StringFlag{Name: "env", Value: "staging"},
+			cli.StringFlag{Name: "region"},
+		}
+		app.Action = func(c *cli.Context) error {
+			if env, err = c.PromptString("env", "Environment"); err != nil {
+				return err
+			}
+			_, err = c.PromptString("region", "Region")
+			return err
+		}
+		app.Run(append([]string{"run"}, args...))
+		return env, out.String(), err
+	}
+
+	env, out, err := run("prod\neu\n")
+	expect(t, err, nil)
+	expect(t, env, "prod")
+	expect(t, out, "Environment [staging]: Region: ")
+
+	env, out, err = run("", "--env", "prod", "--region", "eu")
+	expect(t, err, nil)
+	expect(t, env, "prod")
+	expect(t, out, "")
+
+	env, out, err = run("\n\n")
+	expect(t, env, "staging")
+	expect(t, err.Error(), "--region is required")
+
+	// the required --region is not asked for with --yes
+	env, out, err = run("prod\neu\n", "--assume-yes")
+	expect(t, env, "staging")
+	expect(t, out, "")
+	expect(t, err.Error(), "--region is required")
+}
+
+func TestContext_AssumeYesRenamed(t *testing.T) {
+	defer func(flag cli.BoolFlag) { cli.AssumeYesFlag = flag }(cli.AssumeYesFlag)
+	cli.AssumeYesFlag = cli.BoolFlag{Name: "force, f", Usage: "answer yes to all prompts"}
+
+	var confirmed bool
+	app := cli.NewApp()
+	app.EnableAssumeYes = true
+	app.Reader = strings.NewReader("n\n")
+	app.Writer = &bytes.Buffer{}
+	app.Action = func(c *cli.Context) error {
+		confirmed, _ = c.Confirm("Delete everything?")
+		return nil
+	}
+	app.Run([]string{"run", "-f"})
+
+	expect(t, confirmed, true)
+}